@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/salahfarzin/utils/middlewares"
+)
+
+// APIKeysSchema creates the table used by MySQLKeyStore.
+const APIKeysSchema = `CREATE TABLE IF NOT EXISTS api_keys (
+	id           VARCHAR(32)  NOT NULL PRIMARY KEY,
+	service      VARCHAR(255) NOT NULL,
+	key_hash     CHAR(64)     NOT NULL UNIQUE,
+	scopes       TEXT         NOT NULL,
+	created_at   DATETIME(6)  NOT NULL,
+	expires_at   DATETIME(6)  NULL,
+	last_used_at DATETIME(6)  NULL
+)`
+
+const apiKeyColumns = "id, service, key_hash, scopes, created_at, expires_at, last_used_at"
+
+// MySQLKeyStore is a middlewares.KeyStore backed by the api_keys table.
+type MySQLKeyStore struct {
+	db DBTX
+}
+
+// NewMySQLKeyStore creates a MySQLKeyStore. The table must exist; see
+// APIKeysSchema.
+func NewMySQLKeyStore(db DBTX) *MySQLKeyStore {
+	return &MySQLKeyStore{db: db}
+}
+
+func (s *MySQLKeyStore) Create(ctx context.Context, key *middlewares.APIKey) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		key.ID, key.Service, key.Hash, strings.Join(key.Scopes, ","),
+		key.CreatedAt.UTC(), nullTime(key.ExpiresAt), nullTime(key.LastUsedAt),
+	)
+	return err
+}
+
+func (s *MySQLKeyStore) Get(ctx context.Context, id string) (*middlewares.APIKey, error) {
+	return s.scanKey(s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+}
+
+func (s *MySQLKeyStore) FindByHash(ctx context.Context, hash string) (*middlewares.APIKey, error) {
+	return s.scanKey(s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hash))
+}
+
+func (s *MySQLKeyStore) SetExpiry(ctx context.Context, id string, expiresAt time.Time) error {
+	return s.update(ctx, "UPDATE api_keys SET expires_at = ? WHERE id = ?", nullTime(expiresAt), id)
+}
+
+func (s *MySQLKeyStore) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	return s.update(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", at.UTC(), id)
+}
+
+func (s *MySQLKeyStore) update(ctx context.Context, query string, args ...any) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	// Without CLIENT_FOUND_ROWS, MySQL reports unchanged rows as unaffected,
+	// so only treat an update as missing if the key really does not exist.
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		var exists int
+		err := s.db.QueryRowContext(ctx, "SELECT 1 FROM api_keys WHERE id = ?", args[len(args)-1]).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return middlewares.ErrAPIKeyNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *MySQLKeyStore) scanKey(row *sql.Row) (*middlewares.APIKey, error) {
+	var (
+		key                 middlewares.APIKey
+		scopes              string
+		expiresAt, lastUsed sql.NullTime
+	)
+	err := row.Scan(&key.ID, &key.Service, &key.Hash, &scopes, &key.CreatedAt, &expiresAt, &lastUsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, middlewares.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	key.ExpiresAt = expiresAt.Time
+	key.LastUsedAt = lastUsed.Time
+	return &key, nil
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/salahfarzin/utils/middlewares"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiKeyRowColumns = []string{"id", "service", "key_hash", "scopes", "created_at", "expires_at", "last_used_at"}
+
+func TestMySQLKeyStore_Create(t *testing.T) {
+	raw, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer raw.Close()
+	store := NewMySQLKeyStore(raw)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)")).
+		WithArgs("key-1", "billing", "hash", "invoices:write,reports", created, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = store.Create(context.Background(), &middlewares.APIKey{
+		ID: "key-1", Service: "billing", Hash: "hash", Scopes: []string{"invoices:write", "reports"}, CreatedAt: created,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLKeyStore_FindByHash(t *testing.T) {
+	raw, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer raw.Close()
+	store := NewMySQLKeyStore(raw)
+	ctx := context.Background()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires := created.Add(time.Hour)
+	query := regexp.QuoteMeta("SELECT " + apiKeyColumns + " FROM api_keys WHERE key_hash = ?")
+
+	mock.ExpectQuery(query).WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(apiKeyRowColumns).AddRow("key-1", "billing", "hash", "invoices:write,reports", created, expires, nil))
+	mock.ExpectQuery(query).WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows(apiKeyRowColumns))
+	mock.ExpectQuery(query).WithArgs("hash").
+		WillReturnError(errors.New("connection refused"))
+
+	key, err := store.FindByHash(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", key.ID)
+	assert.Equal(t, "billing", key.Service)
+	assert.Equal(t, []string{"invoices:write", "reports"}, key.Scopes)
+	assert.Equal(t, created, key.CreatedAt)
+	assert.Equal(t, expires, key.ExpiresAt)
+	assert.True(t, key.LastUsedAt.IsZero())
+
+	_, err = store.FindByHash(ctx, "missing")
+	assert.ErrorIs(t, err, middlewares.ErrAPIKeyNotFound)
+
+	_, err = store.FindByHash(ctx, "hash")
+	assert.EqualError(t, err, "connection refused")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLKeyStore_Get(t *testing.T) {
+	raw, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer raw.Close()
+	store := NewMySQLKeyStore(raw)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + apiKeyColumns + " FROM api_keys WHERE id = ?")).WithArgs("key-1").
+		WillReturnRows(sqlmock.NewRows(apiKeyRowColumns).AddRow("key-1", "billing", "hash", "", time.Now(), nil, nil))
+
+	key, err := store.Get(context.Background(), "key-1")
+	require.NoError(t, err)
+	assert.Empty(t, key.Scopes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLKeyStore_Update(t *testing.T) {
+	raw, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer raw.Close()
+	store := NewMySQLKeyStore(raw)
+	ctx := context.Background()
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	exists := regexp.QuoteMeta("SELECT 1 FROM api_keys WHERE id = ?")
+
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET expires_at = ? WHERE id = ?")).
+		WithArgs(at, "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// An unchanged row is reported as unaffected; the key still exists.
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET last_used_at = ? WHERE id = ?")).
+		WithArgs(at, "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(exists).WithArgs("key-1").
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE api_keys SET last_used_at = ? WHERE id = ?")).
+		WithArgs(at, "missing").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(exists).WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+	assert.NoError(t, store.SetExpiry(ctx, "key-1", at))
+	assert.NoError(t, store.TouchLastUsed(ctx, "key-1", at))
+	assert.ErrorIs(t, store.TouchLastUsed(ctx, "missing", at), middlewares.ErrAPIKeyNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
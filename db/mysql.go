@@ -13,18 +13,19 @@ import (
 )
 
 // MySQLConfig holds the configuration for the MySQL connection.
+// It can be filled from the environment with utils.LoadEnv.
 type MySQLConfig struct {
-	User            string
-	Password        string
-	Address         string
-	Name            string
-	SSLCA           string
-	SSLCert         string
-	SSLKey          string
-	SSLVerify       bool
-	MaxOpenConns    int
-	MaxIdleConns    int
-	ConnMaxLifetime int
+	User            string `env:"DB_USER"`
+	Password        string `env:"DB_PASSWORD"`
+	Address         string `env:"DB_ADDRESS" required:"true"`
+	Name            string `env:"DB_NAME" required:"true"`
+	SSLCA           string `env:"DB_SSL_CA"`
+	SSLCert         string `env:"DB_SSL_CERT"`
+	SSLKey          string `env:"DB_SSL_KEY"`
+	SSLVerify       bool   `env:"DB_SSL_VERIFY" default:"true"`
+	MaxOpenConns    int    `env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int    `env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime int    `env:"DB_CONN_MAX_LIFETIME"`
 }
 
 func NewMySQLStorage(cfg MySQLConfig) (*sql.DB, error) {
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RevocationsSchema creates the table used by MySQLRevocationStore.
+const RevocationsSchema = `CREATE TABLE IF NOT EXISTS revocations (
+	kind       VARCHAR(8)   NOT NULL,
+	subject    VARCHAR(255) NOT NULL,
+	revoked_at DATETIME(6)  NULL,
+	expires_at DATETIME(6)  NOT NULL,
+	PRIMARY KEY (kind, subject),
+	INDEX idx_revocations_expires_at (expires_at)
+)`
+
+// MySQLRevocationStore is a middlewares.RevocationStore backed by the
+// revocations table.
+type MySQLRevocationStore struct {
+	db DBTX
+}
+
+// NewMySQLRevocationStore creates a MySQLRevocationStore. The table must
+// exist; see RevocationsSchema.
+func NewMySQLRevocationStore(db DBTX) *MySQLRevocationStore {
+	return &MySQLRevocationStore{db: db}
+}
+
+func (s *MySQLRevocationStore) RevokeToken(ctx context.Context, tokenHash string, expiresAt time.Time) error {
+	return s.revoke(ctx, "token", tokenHash, expiresAt)
+}
+
+// RevokeUser never moves an existing revocation back in time.
+func (s *MySQLRevocationStore) RevokeUser(ctx context.Context, userID string, revokedAt, until time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO revocations (kind, subject, revoked_at, expires_at) VALUES ('user', ?, ?, ?)
+		ON DUPLICATE KEY UPDATE revoked_at = GREATEST(revoked_at, VALUES(revoked_at)), expires_at = GREATEST(expires_at, VALUES(expires_at))`,
+		userID, revokedAt.UTC(), until.UTC(),
+	)
+	return err
+}
+
+func (s *MySQLRevocationStore) BanUser(ctx context.Context, userID string, until time.Time) error {
+	return s.revoke(ctx, "ban", userID, until)
+}
+
+// revoke never shortens an existing revocation.
+func (s *MySQLRevocationStore) revoke(ctx context.Context, kind, subject string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO revocations (kind, subject, expires_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE expires_at = GREATEST(expires_at, VALUES(expires_at))`,
+		kind, subject, until.UTC(),
+	)
+	return err
+}
+
+// IsRevoked checks user revocations by issue time only: once every token
+// they cover has expired, they match nothing new and PurgeExpired drops them.
+func (s *MySQLRevocationStore) IsRevoked(ctx context.Context, tokenHash, userID string, issuedAt time.Time) (bool, error) {
+	now := time.Now().UTC()
+	var found int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT 1 FROM revocations
+		WHERE (kind = 'token' AND subject = ? AND expires_at > ?)
+		OR (kind = 'ban' AND subject = ? AND expires_at > ?)
+		OR (kind = 'user' AND subject = ? AND ? <= revoked_at)
+		LIMIT 1`,
+		tokenHash, now, userID, now, userID, issuedAt.UTC(),
+	).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PurgeExpired deletes revocations that no longer apply and
+// returns how many were removed.
+func (s *MySQLRevocationStore) PurgeExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM revocations WHERE expires_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const isRevokedQuery = `SELECT 1 FROM revocations
+		WHERE (kind = 'token' AND subject = ? AND expires_at > ?)
+		OR (kind = 'ban' AND subject = ? AND expires_at > ?)
+		OR (kind = 'user' AND subject = ? AND ? <= revoked_at)
+		LIMIT 1`
+
+func TestMySQLRevocationStore_Revoke(t *testing.T) {
+	raw, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer raw.Close()
+	store := NewMySQLRevocationStore(raw)
+	ctx := context.Background()
+	revokedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	until := revokedAt.Add(time.Hour)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO revocations (kind, subject, expires_at) VALUES (?, ?, ?)")).
+		WithArgs("token", "hash", until).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO revocations (kind, subject, revoked_at, expires_at) VALUES ('user', ?, ?, ?)")).
+		WithArgs("user-1", revokedAt, until).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO revocations (kind, subject, expires_at) VALUES (?, ?, ?)")).
+		WithArgs("ban", "user-2", until).
+		WillReturnError(errors.New("connection refused"))
+
+	assert.NoError(t, store.RevokeToken(ctx, "hash", until))
+	assert.NoError(t, store.RevokeUser(ctx, "user-1", revokedAt, until))
+	assert.EqualError(t, store.BanUser(ctx, "user-2", until), "connection refused")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRevocationStore_IsRevoked(t *testing.T) {
+	raw, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer raw.Close()
+	store := NewMySQLRevocationStore(raw)
+	ctx := context.Background()
+	issuedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(isRevokedQuery)).
+		WithArgs("hash", sqlmock.AnyArg(), "user-1", sqlmock.AnyArg(), "user-1", issuedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(isRevokedQuery)).
+		WithArgs("hash", sqlmock.AnyArg(), "user-1", sqlmock.AnyArg(), "user-1", issuedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}))
+	mock.ExpectQuery(regexp.QuoteMeta(isRevokedQuery)).
+		WillReturnError(errors.New("connection refused"))
+
+	revoked, err := store.IsRevoked(ctx, "hash", "user-1", issuedAt)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = store.IsRevoked(ctx, "hash", "user-1", issuedAt)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = store.IsRevoked(ctx, "hash", "user-1", issuedAt)
+	assert.EqualError(t, err, "connection refused")
+	assert.False(t, revoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMySQLRevocationStore_PurgeExpired(t *testing.T) {
+	raw, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer raw.Close()
+	store := NewMySQLRevocationStore(raw)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM revocations WHERE expires_at <= ?")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	n, err := store.PurgeExpired(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
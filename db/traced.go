@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/salahfarzin/utils/tracing"
+)
+
+// DBTX is the subset of *sql.DB, *sql.Tx and *TracedDB used by the stores in
+// this package.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// TracedDB wraps a *sql.DB and records ExecContext, QueryContext and
+// QueryRowContext as client spans of the trace in ctx. Other methods, such as
+// BeginTx, are passed through untraced.
+type TracedDB struct {
+	*sql.DB
+	// System is reported as the db.system attribute; defaults to "mysql".
+	System string
+}
+
+// NewTracedDB wraps db with tracing.
+func NewTracedDB(db *sql.DB) *TracedDB {
+	return &TracedDB{DB: db, System: "mysql"}
+}
+
+func (t *TracedDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := t.startSpan(ctx, query)
+	defer span.End()
+	res, err := t.DB.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return res, err
+}
+
+func (t *TracedDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := t.startSpan(ctx, query)
+	defer span.End()
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+// QueryRowContext ends its span when the query has run; errors reported
+// later by Scan are not recorded.
+func (t *TracedDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := t.startSpan(ctx, query)
+	defer span.End()
+	row := t.DB.QueryRowContext(ctx, query, args...)
+	span.RecordError(row.Err())
+	return row
+}
+
+func (t *TracedDB) startSpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	system := t.System
+	if system == "" {
+		system = "mysql"
+	}
+	return tracing.StartSpan(ctx, "db."+queryOperation(query),
+		tracing.WithSpanKind(tracing.SpanKindClient),
+		tracing.WithAttributes(map[string]any{
+			"db.system":    system,
+			"db.statement": query,
+		}),
+	)
+}
+
+// queryOperation returns the lower-cased first keyword of query, e.g.
+// "select", so span names stay low-cardinality.
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "query"
+	}
+	return strings.ToLower(fields[0])
+}
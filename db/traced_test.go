@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/salahfarzin/utils/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracedDB_RecordsSpans(t *testing.T) {
+	rec := tracing.NewRecorder()
+	tracing.SetSpanProcessor(rec)
+	t.Cleanup(func() { tracing.SetSpanProcessor(nil) })
+
+	// sql.Open does not connect; closing it makes every call fail fast.
+	raw, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:1)/db")
+	require.NoError(t, err)
+	require.NoError(t, raw.Close())
+	traced := NewTracedDB(raw)
+
+	ctx, parent := tracing.StartSpan(context.Background(), "handler")
+	_, err = traced.ExecContext(ctx, "  UPDATE t SET a = ?", 1)
+	require.Error(t, err)
+
+	span := rec.Find("db.update")
+	require.NotNil(t, span)
+	assert.Equal(t, tracing.SpanKindClient, span.Kind())
+	assert.Equal(t, parent.Context().SpanID, span.Context().ParentSpanID)
+	assert.Equal(t, "mysql", span.Attributes()["db.system"])
+	status, _ := span.Status()
+	assert.Equal(t, tracing.StatusError, status)
+
+	assert.Error(t, traced.QueryRowContext(ctx, "SELECT 1").Scan(new(int)))
+	assert.NotNil(t, rec.Find("db.select"))
+}
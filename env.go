@@ -0,0 +1,324 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvStatus describes how an Env lookup was resolved.
+type EnvStatus string
+
+const (
+	EnvSet       EnvStatus = "set"
+	EnvDefaulted EnvStatus = "defaulted"
+	EnvMissing   EnvStatus = "missing"
+	EnvInvalid   EnvStatus = "invalid"
+)
+
+// redacted replaces sensitive values in reports.
+const redacted = "[REDACTED]"
+
+// EnvLookup records a single key read through an Env.
+type EnvLookup struct {
+	Key       string
+	Status    EnvStatus
+	Value     string
+	Err       error
+	Sensitive bool
+}
+
+// Env is a strict environment reader. Unlike GetEnvAsInt and friends, it
+// remembers every lookup so that missing or malformed values can be reported
+// together via Err, and the configuration that was actually used can be
+// logged via Report.
+//
+// Accessors always return a usable value (the fallback on failure), which
+// lets a whole config be read before checking Err once.
+type Env struct {
+	src Source
+
+	mu      sync.Mutex
+	lookups []EnvLookup
+	index   map[string]int
+}
+
+// NewEnv creates an Env reading from the Source set with SetSource.
+func NewEnv() *Env {
+	return &Env{index: make(map[string]int)}
+}
+
+// NewEnvFrom creates an Env reading from src.
+func NewEnvFrom(src Source) *Env {
+	return &Env{src: src, index: make(map[string]int)}
+}
+
+func (e *Env) source() Source {
+	if e.src != nil {
+		return e.src
+	}
+	return CurrentSource()
+}
+
+// String reads a string, using fallback when the key is not set.
+func (e *Env) String(key, fallback string) string {
+	return readEnv(e, key, fallback, false, func(s string) (string, error) { return s, nil })
+}
+
+// MustString reads a string that is required to be set.
+func (e *Env) MustString(key string) string {
+	return readEnv(e, key, "", true, func(s string) (string, error) { return s, nil })
+}
+
+// Int reads a base-10 int64.
+func (e *Env) Int(key string, fallback int64) int64 {
+	return readEnv(e, key, fallback, false, parseInt)
+}
+
+// MustInt reads a base-10 int64 that is required to be set.
+func (e *Env) MustInt(key string) int64 {
+	return readEnv(e, key, 0, true, parseInt)
+}
+
+// Bool reads a boolean in any form accepted by strconv.ParseBool.
+func (e *Env) Bool(key string, fallback bool) bool {
+	return readEnv(e, key, fallback, false, strconv.ParseBool)
+}
+
+// Duration reads a duration such as "1m30s".
+func (e *Env) Duration(key string, fallback time.Duration) time.Duration {
+	return readEnv(e, key, fallback, false, time.ParseDuration)
+}
+
+// Float reads a float64.
+func (e *Env) Float(key string, fallback float64) float64 {
+	return readEnv(e, key, fallback, false, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+}
+
+// URL reads an absolute URL. The fallback is parsed the same way; an empty
+// fallback yields nil when the key is not set.
+func (e *Env) URL(key, fallback string) *url.URL {
+	var def *url.URL
+	if fallback != "" {
+		def, _ = parseAbsURL(fallback)
+	}
+	return readEnv(e, key, def, false, parseAbsURL)
+}
+
+// StringSlice reads a list separated by sep, trimming each element.
+func (e *Env) StringSlice(key, sep string, fallback []string) []string {
+	return readEnv(e, key, fallback, false, func(s string) ([]string, error) {
+		if strings.TrimSpace(s) == "" {
+			return nil, nil
+		}
+		return SplitAndTrim(s, sep), nil
+	})
+}
+
+// Secret reads a sensitive string. Its value is always redacted in reports,
+// and the returned Secret redacts itself when printed or logged.
+func (e *Env) Secret(key string) Secret {
+	v := readEnv(e, key, "", false, func(s string) (string, error) { return s, nil })
+	e.markSensitive(key)
+	return Secret(v)
+}
+
+// Enum reads a string that must be one of allowed.
+func (e *Env) Enum(key, fallback string, allowed ...string) string {
+	return readEnv(e, key, fallback, false, func(s string) (string, error) {
+		if !slices.Contains(allowed, s) {
+			return "", fmt.Errorf("%q is not one of %s", s, strings.Join(allowed, ", "))
+		}
+		return s, nil
+	})
+}
+
+// Err returns every missing or invalid lookup joined into one error, or nil.
+func (e *Env) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	for _, l := range e.lookups {
+		if l.Err != nil {
+			errs = append(errs, l.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Lookups returns the recorded lookups in the order keys were first read.
+// Values of secrets, sensitive-looking keys and URL passwords are redacted.
+func (e *Env) Lookups() []EnvLookup {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make([]EnvLookup, len(e.lookups))
+	for i, l := range e.lookups {
+		if l.Sensitive && l.Value != "" {
+			l.Value = redacted
+		} else {
+			l.Value = redactValue(l.Key, l.Value)
+		}
+		out[i] = l
+	}
+	return out
+}
+
+// Report renders Lookups as one "KEY=value (status)" line per key, suitable
+// for logging at startup.
+func (e *Env) Report() string {
+	var b strings.Builder
+	for _, l := range e.Lookups() {
+		fmt.Fprintf(&b, "%s=%s (%s)", l.Key, l.Value, l.Status)
+		if l.Err != nil {
+			fmt.Fprintf(&b, ": %v", errors.Unwrap(l.Err))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (e *Env) record(l EnvLookup) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if i, ok := e.index[l.Key]; ok {
+		e.lookups[i] = l
+		return
+	}
+	e.index[l.Key] = len(e.lookups)
+	e.lookups = append(e.lookups, l)
+}
+
+func (e *Env) markSensitive(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if i, ok := e.index[key]; ok {
+		e.lookups[i].Sensitive = true
+	}
+}
+
+func readEnv[T any](e *Env, key string, fallback T, required bool, parse func(string) (T, error)) T {
+	resolved, err := resolveEnv(e.source(), key)
+	if err != nil {
+		e.record(EnvLookup{Key: key, Status: EnvInvalid, Err: &EnvVarError{Key: key, Err: err}, Sensitive: true})
+		return fallback
+	}
+	raw := resolved.value
+	if !resolved.found {
+		if required {
+			e.record(EnvLookup{Key: key, Status: EnvMissing, Err: &EnvVarError{Key: key, Err: ErrMissingEnv}})
+			return fallback
+		}
+		e.record(EnvLookup{Key: key, Status: EnvDefaulted, Value: formatEnvValue(fallback)})
+		return fallback
+	}
+
+	v, err := parse(raw)
+	if err != nil {
+		err = redactError(err, key, raw, resolved.secret)
+		e.record(EnvLookup{Key: key, Status: EnvInvalid, Value: raw, Err: &EnvVarError{Key: key, Err: err}, Sensitive: resolved.secret})
+		return fallback
+	}
+	e.record(EnvLookup{Key: key, Status: EnvSet, Value: raw, Sensitive: resolved.secret})
+	return v
+}
+
+func formatEnvValue(v any) string {
+	switch v := v.(type) {
+	case []string:
+		return strings.Join(v, ",")
+	case *url.URL:
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func parseInt(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func parseAbsURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an absolute URL", s)
+	}
+	return u, nil
+}
+
+func redactValue(key, value string) string {
+	if value == "" {
+		return value
+	}
+	if isSensitiveKey(key) {
+		return redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	// DSNs that are not valid URLs, such as user:pass@tcp(host)/db or ones
+	// that fail to parse, may still carry a password before the last "@".
+	if i := strings.LastIndex(value, "@"); i > 0 && strings.Contains(value[:i], ":") {
+		return redacted
+	}
+	return value
+}
+
+// redactError hides value in err the way Report shows it. Values that are
+// redacted entirely are dropped from the message, since parse errors may
+// quote only part of them.
+func redactError(err error, key, value string, sensitive bool) error {
+	shown := redacted
+	if !sensitive {
+		shown = redactValue(key, value)
+	}
+	if shown == value {
+		return err
+	}
+	if shown == redacted {
+		msg := "invalid value " + redacted
+		var ne *strconv.NumError
+		if errors.As(err, &ne) {
+			msg += ": " + ne.Err.Error()
+		}
+		return &redactedError{err: err, msg: msg}
+	}
+	msg := strings.ReplaceAll(err.Error(), strconv.Quote(value), strconv.Quote(shown))
+	return &redactedError{err: err, msg: strings.ReplaceAll(msg, value, shown)}
+}
+
+// redactedError replaces the message of err but still matches it with
+// errors.Is and errors.As.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// isSensitiveKey reports whether a key name suggests its value is a secret.
+func isSensitiveKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, marker := range []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "CREDENTIAL", "PRIVATE", "_KEY", "APIKEY"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
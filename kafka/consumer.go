@@ -8,21 +8,23 @@ import (
 	"time"
 
 	"github.com/salahfarzin/logger"
+	"github.com/salahfarzin/utils/tracing"
 	kafkago "github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl/scram"
 	"go.uber.org/zap"
 )
 
 // ConsumerConfig holds configuration for the Kafka consumer.
+// It can be filled from the environment with utils.LoadEnv.
 type ConsumerConfig struct {
-	Brokers            []string
-	Username           string
-	Password           string
-	Topic              string
-	GroupID            string
-	UseSSL             bool
-	InsecureSkipVerify bool
-	CACertPath         string
+	Brokers            []string `env:"KAFKA_BROKERS" required:"true"`
+	Username           string   `env:"KAFKA_USERNAME"`
+	Password           string   `env:"KAFKA_PASSWORD"`
+	Topic              string   `env:"KAFKA_TOPIC" required:"true"`
+	GroupID            string   `env:"KAFKA_GROUP_ID"`
+	UseSSL             bool     `env:"KAFKA_USE_SSL"`
+	InsecureSkipVerify bool     `env:"KAFKA_INSECURE_SKIP_VERIFY"`
+	CACertPath         string   `env:"KAFKA_CA_CERT_PATH"`
 }
 
 func NewConsumer(brokers []string, topic string, groupID string, handler Handler) {
@@ -166,8 +168,23 @@ func RunConsumerLoopWithSleeper(reader MessageReader, handler Handler, sleeper S
 			zap.Int64("offset", msg.Offset),
 			zap.Time("time", msg.Time))
 
+		// Each message is handled in a consumer span that continues the
+		// producer's trace.
+		msgCtx, span := tracing.StartSpan(messageContext(ctx, msg), "kafka.consume "+msg.Topic,
+			tracing.WithSpanKind(tracing.SpanKindConsumer),
+			tracing.WithAttributes(map[string]any{
+				"messaging.destination":       msg.Topic,
+				"messaging.kafka.partition":   msg.Partition,
+				"messaging.kafka.offset":      msg.Offset,
+				"messaging.kafka.message_key": string(msg.Key),
+			}),
+		)
+
 		// Use the exported handler for testability
-		if err := handler.Handle(ctx, msg.Key, msg.Value); err != nil {
+		err = handler.Handle(msgCtx, msg.Key, msg.Value)
+		span.RecordError(err)
+		span.End()
+		if err != nil {
 			log.Error("Kafka consumer: failed to handle message", zap.Error(err))
 			continue
 		}
@@ -9,6 +9,7 @@ import (
 
 	kafkaPkg "github.com/salahfarzin/utils/kafka"
 	"github.com/salahfarzin/utils/testutils"
+	"github.com/salahfarzin/utils/tracing"
 	kafka "github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -134,6 +135,54 @@ func TestRunConsumerLoop(t *testing.T) {
 		mockHandler.AssertExpectations(t)
 	})
 
+	t.Run("Tenant header is propagated", func(t *testing.T) {
+		mockReader := &MockMessageReader{}
+		mockHandler := &MockHandler{}
+
+		msg := kafka.Message{
+			Key:     []byte("key"),
+			Value:   []byte("value"),
+			Headers: []kafka.Header{{Key: tracing.TenantIDHeader, Value: []byte("acme")}},
+		}
+
+		mockReader.On("ReadMessage", mock.Anything).Return(msg, nil).Once()
+		mockReader.On("ReadMessage", mock.Anything).Return(kafka.Message{}, context.Canceled).Once()
+		mockHandler.On("Handle", mock.MatchedBy(func(ctx context.Context) bool {
+			return tracing.GetTenantIDFromContext(ctx) == "acme"
+		}), []byte("key"), []byte("value")).Return(nil)
+
+		kafkaPkg.RunConsumerLoopWithSleeper(mockReader, mockHandler, &kafkaPkg.TestSleeper{})
+
+		mockHandler.AssertExpectations(t)
+	})
+
+	t.Run("Traceparent header is continued in a consumer span", func(t *testing.T) {
+		mockReader := &MockMessageReader{}
+		mockHandler := &MockHandler{}
+
+		msg := kafka.Message{
+			Topic:   "orders",
+			Key:     []byte("key"),
+			Value:   []byte("value"),
+			Headers: []kafka.Header{{Key: "traceparent", Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")}},
+		}
+
+		mockReader.On("ReadMessage", mock.Anything).Return(msg, nil).Once()
+		mockReader.On("ReadMessage", mock.Anything).Return(kafka.Message{}, context.Canceled).Once()
+		mockHandler.On("Handle", mock.MatchedBy(func(ctx context.Context) bool {
+			span := tracing.SpanFromContext(ctx)
+			return span != nil &&
+				span.Name() == "kafka.consume orders" &&
+				span.Kind() == tracing.SpanKindConsumer &&
+				span.Context().TraceID == "4bf92f3577b34da6a3ce929d0e0e4736" &&
+				span.Context().ParentSpanID == "00f067aa0ba902b7"
+		}), []byte("key"), []byte("value")).Return(nil)
+
+		kafkaPkg.RunConsumerLoopWithSleeper(mockReader, mockHandler, &kafkaPkg.TestSleeper{})
+
+		mockHandler.AssertExpectations(t)
+	})
+
 	t.Run("Context canceled error", func(t *testing.T) {
 		mockReader := &MockMessageReader{}
 		mockHandler := &MockHandler{}
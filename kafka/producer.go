@@ -2,14 +2,16 @@ package kafka
 
 import (
 	"context"
+	"strings"
 
+	"github.com/salahfarzin/utils/tracing"
 	kafkago "github.com/segmentio/kafka-go"
 )
 
 // ProducerConfig holds configuration for the Kafka producer.
 type ProducerConfig struct {
-	Brokers []string
-	Topic   string
+	Brokers []string `env:"KAFKA_BROKERS" required:"true"`
+	Topic   string   `env:"KAFKA_TOPIC" required:"true"`
 }
 
 // Producer wraps kafkago.Writer for producing events.
@@ -29,13 +31,61 @@ func NewProducer(cfg ProducerConfig) *Producer {
 	}
 }
 
-// Produce sends a raw message to Kafka.
+// Produce sends a raw message to Kafka. The tenant of ctx, if any, is sent
+// in the X-Tenant-Id header. The write is recorded as a producer span whose
+// trace context is sent in the traceparent and tracestate headers.
 func (p *Producer) Produce(ctx context.Context, key, value []byte) error {
+	ctx, span := tracing.StartSpan(ctx, "kafka.produce "+p.Writer.Topic,
+		tracing.WithSpanKind(tracing.SpanKindProducer),
+		tracing.WithAttributes(map[string]any{"messaging.destination": p.Writer.Topic}),
+	)
+	defer span.End()
+
 	msg := kafkago.Message{
-		Key:   key,
-		Value: value,
+		Key:     key,
+		Value:   value,
+		Headers: messageHeaders(ctx),
+	}
+	err := p.Writer.WriteMessages(ctx, msg)
+	span.RecordError(err)
+	return err
+}
+
+// messageHeaders returns the Kafka headers that propagate ctx.
+func messageHeaders(ctx context.Context) []kafkago.Header {
+	var headers []kafkago.Header
+	if tenantID := tracing.GetTenantIDFromContext(ctx); tenantID != "" {
+		headers = append(headers, kafkago.Header{Key: tracing.TenantIDHeader, Value: []byte(tenantID)})
+	}
+	if tc, ok := tracing.TraceContextFromContext(ctx); ok && tc.IsValid() {
+		headers = append(headers, kafkago.Header{Key: tracing.TraceparentHeader, Value: []byte(tc.Traceparent())})
+		if tc.State != "" {
+			headers = append(headers, kafkago.Header{Key: tracing.TracestateHeader, Value: []byte(tc.State)})
+		}
+	}
+	return headers
+}
+
+// messageContext returns ctx with the values propagated in msg's headers.
+// A valid traceparent becomes the parent of spans started from ctx.
+func messageContext(ctx context.Context, msg kafkago.Message) context.Context {
+	var tracestate string
+	var parent tracing.TraceContext
+	for _, h := range msg.Headers {
+		switch {
+		case strings.EqualFold(h.Key, tracing.TenantIDHeader):
+			ctx = tracing.InjectTenantIDToContext(ctx, string(h.Value))
+		case strings.EqualFold(h.Key, tracing.TraceparentHeader):
+			parent, _ = tracing.ParseTraceparent(string(h.Value))
+		case strings.EqualFold(h.Key, tracing.TracestateHeader):
+			tracestate = string(h.Value)
+		}
+	}
+	if parent.IsValid() {
+		parent.State = tracestate
+		ctx = tracing.InjectTraceContext(ctx, parent)
 	}
-	return p.Writer.WriteMessages(ctx, msg)
+	return ctx
 }
 
 // Close closes the underlying Kafka writer.
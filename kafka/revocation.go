@@ -0,0 +1,41 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/salahfarzin/utils/middlewares"
+)
+
+// RevocationHandler is a Handler that applies middlewares.RevocationEvent
+// messages to Store, so revocations made on one instance reach the
+// in-memory stores of all others:
+//
+//	store := middlewares.NewMemoryRevocationStore()
+//	kafka.NewConsumer(brokers, "auth.revocations", instanceID, &kafka.RevocationHandler{Store: store})
+type RevocationHandler struct {
+	Store middlewares.RevocationStore
+}
+
+func (h *RevocationHandler) Handle(ctx context.Context, _, value []byte) error {
+	var event middlewares.RevocationEvent
+	if err := json.Unmarshal(value, &event); err != nil {
+		return fmt.Errorf("failed to decode revocation event: %w", err)
+	}
+	return event.Apply(ctx, h.Store)
+}
+
+// PublishRevocation sends event for RevocationHandlers to apply. Events are
+// keyed by their subject so that updates to it stay ordered.
+func (p *Producer) PublishRevocation(ctx context.Context, event middlewares.RevocationEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	key := event.TokenHash
+	if event.Type == middlewares.RevokeUserEvent || event.Type == middlewares.BanUserEvent {
+		key = event.UserID
+	}
+	return p.Produce(ctx, []byte(key), value)
+}
@@ -0,0 +1,38 @@
+package kafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	kafkaPkg "github.com/salahfarzin/utils/kafka"
+	"github.com/salahfarzin/utils/middlewares"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationHandler(t *testing.T) {
+	ctx := context.Background()
+	store := middlewares.NewMemoryRevocationStore()
+	var handler kafkaPkg.Handler = &kafkaPkg.RevocationHandler{Store: store}
+
+	revokedAt := time.Now()
+	value, err := json.Marshal(middlewares.RevocationEvent{
+		Type:      middlewares.RevokeUserEvent,
+		UserID:    "user-1",
+		RevokedAt: revokedAt,
+		ExpiresAt: revokedAt.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.NoError(t, handler.Handle(ctx, []byte("user-1"), value))
+
+	revoked, err := store.IsRevoked(ctx, "", "user-1", revokedAt.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, "", "user-1", revokedAt.Add(time.Minute))
+	assert.False(t, revoked, "tokens issued after the revocation are accepted")
+
+	assert.Error(t, handler.Handle(ctx, nil, []byte("not json")))
+	assert.Error(t, handler.Handle(ctx, nil, []byte(`{"type":"unknown"}`)))
+}
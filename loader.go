@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingEnv is reported for a required variable that is not set.
+var ErrMissingEnv = errors.New("required variable is not set")
+
+// ErrRequiredWithDefault is reported for a field tagged both required and
+// default, since a default would make the requirement meaningless.
+var ErrRequiredWithDefault = errors.New(`field has both required:"true" and a default`)
+
+// EnvVarError describes a problem with a single environment variable.
+type EnvVarError struct {
+	Key string
+	Err error
+}
+
+func (e *EnvVarError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e *EnvVarError) Unwrap() error {
+	return e.Err
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// LoadEnv fills the struct pointed to by cfg from environment variables,
+// resolved through the Source set with SetSource.
+//
+// Fields are configured with struct tags:
+//
+//	env:"KEY"         variable name; fields without it are skipped
+//	default:"value"   used when the variable is not set
+//	required:"true"   report an error when the variable is not set; a field
+//	                  may not have both required and default
+//	sep:","           separator for slice fields (defaults to ",")
+//	prefix:"DB_"      on nested struct fields, prepended to every inner key;
+//	                  required to load a pointer-to-struct field, which is
+//	                  left nil unless one of its variables is set
+//
+// Like the other env helpers, a KEY_FILE variable or a secret:// reference
+// can supply the value of KEY; use the Secret type for fields that must not
+// show up in logs.
+//
+// Supported field types are strings, bools, ints, uints, floats,
+// time.Duration, slices of those and nested structs. Instead of falling back
+// silently, LoadEnv keeps going after a bad value and returns one error that
+// lists every missing or malformed variable.
+func LoadEnv(cfg any) error {
+	return LoadEnvFrom(CurrentSource(), cfg)
+}
+
+// LoadEnvFrom is like LoadEnv but resolves keys from src.
+func LoadEnvFrom(src Source, cfg any) error {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("LoadEnv: expected a non-nil pointer to a struct, got %T", cfg)
+	}
+
+	var errs []error
+	loadStruct(src, rv.Elem(), "", nil, &errs)
+	return errors.Join(errs...)
+}
+
+// loadStruct fills the tagged fields of v and reports whether any of their
+// variables were set. loading holds the pointer types being loaded, so that
+// recursive types stop at the first repetition.
+func loadStruct(src Source, v reflect.Value, prefix string, loading []reflect.Type, errs *[]error) bool {
+	resolvedAny := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		key, hasKey := field.Tag.Lookup("env")
+		if !hasKey {
+			if loadNested(src, field, fv, prefix, loading, errs) {
+				resolvedAny = true
+			}
+			continue
+		}
+		key = prefix + key
+
+		_, hasDefault := field.Tag.Lookup("default")
+		if hasDefault && field.Tag.Get("required") == "true" {
+			*errs = append(*errs, &EnvVarError{Key: key, Err: ErrRequiredWithDefault})
+			continue
+		}
+
+		resolved, err := resolveEnv(src, key)
+		if err != nil {
+			resolvedAny = true
+			*errs = append(*errs, &EnvVarError{Key: key, Err: err})
+			continue
+		}
+		value, ok := resolved.value, resolved.found
+		if ok {
+			resolvedAny = true
+		} else {
+			if field.Tag.Get("required") == "true" {
+				*errs = append(*errs, &EnvVarError{Key: key, Err: ErrMissingEnv})
+				continue
+			}
+			value, ok = field.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+		}
+
+		sep := field.Tag.Get("sep")
+		if sep == "" {
+			sep = ","
+		}
+		if err := setField(fv, value, sep); err != nil {
+			*errs = append(*errs, &EnvVarError{Key: key, Err: redactError(err, key, value, resolved.secret)})
+		}
+	}
+	return resolvedAny
+}
+
+// loadNested loads a field without an env tag. Struct values are always
+// walked; pointers to structs only with a prefix tag. A nil pointer is
+// allocated only if one of its variables is set, so optional sections and
+// unrelated pointers such as *http.Client stay nil.
+func loadNested(src Source, field reflect.StructField, fv reflect.Value, prefix string, loading []reflect.Type, errs *[]error) bool {
+	inner, hasPrefix := field.Tag.Lookup("prefix")
+	prefix += inner
+
+	switch {
+	case fv.Kind() == reflect.Struct:
+		return loadStruct(src, fv, prefix, loading, errs)
+	case fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct && hasPrefix:
+		if slices.Contains(loading, fv.Type()) {
+			return false
+		}
+		loading = append(loading, fv.Type())
+		if !fv.IsNil() {
+			return loadStruct(src, fv.Elem(), prefix, loading, errs)
+		}
+
+		var nestedErrs []error
+		nested := reflect.New(fv.Type().Elem())
+		if !loadStruct(src, nested.Elem(), prefix, loading, &nestedErrs) {
+			return false
+		}
+		fv.Set(nested)
+		*errs = append(*errs, nestedErrs...)
+		return true
+	}
+	return false
+}
+
+func setField(fv reflect.Value, value, sep string) error {
+	if fv.Kind() == reflect.Slice {
+		var parts []string
+		if strings.TrimSpace(value) != "" {
+			parts = SplitAndTrim(value, sep)
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setScalar(slice.Index(i), part); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setScalar(fv, value)
+}
+
+func setScalar(fv reflect.Value, value string) error {
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
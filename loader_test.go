@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testDBConfig struct {
+	Host     string `env:"HOST" required:"true"`
+	Port     int    `env:"PORT" default:"3306"`
+	ReadOnly bool   `env:"READ_ONLY"`
+}
+
+type testConfig struct {
+	Name     string        `env:"TEST_LOAD_NAME" default:"svc"`
+	Debug    bool          `env:"TEST_LOAD_DEBUG"`
+	Workers  int64         `env:"TEST_LOAD_WORKERS" default:"4"`
+	Ratio    float64       `env:"TEST_LOAD_RATIO"`
+	Timeout  time.Duration `env:"TEST_LOAD_TIMEOUT" default:"5s"`
+	Brokers  []string      `env:"TEST_LOAD_BROKERS"`
+	Ports    []int         `env:"TEST_LOAD_PORTS" sep:";"`
+	Primary  testDBConfig  `prefix:"TEST_LOAD_PRIMARY_"`
+	Replica  *testDBConfig `prefix:"TEST_LOAD_REPLICA_"`
+	Ignored  string
+	internal string `env:"TEST_LOAD_INTERNAL"`
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("TEST_LOAD_DEBUG", "true")
+	t.Setenv("TEST_LOAD_RATIO", "0.25")
+	t.Setenv("TEST_LOAD_BROKERS", "a:9092, b:9092")
+	t.Setenv("TEST_LOAD_PORTS", "80;443")
+	t.Setenv("TEST_LOAD_PRIMARY_HOST", "primary")
+	t.Setenv("TEST_LOAD_REPLICA_HOST", "replica")
+	t.Setenv("TEST_LOAD_REPLICA_READ_ONLY", "1")
+	t.Setenv("TEST_LOAD_INTERNAL", "secret")
+
+	var cfg testConfig
+	if err := LoadEnv(&cfg); err != nil {
+		t.Fatalf("LoadEnv() error = %v", err)
+	}
+
+	want := testConfig{
+		Name:    "svc",
+		Debug:   true,
+		Workers: 4,
+		Ratio:   0.25,
+		Timeout: 5 * time.Second,
+		Brokers: []string{"a:9092", "b:9092"},
+		Ports:   []int{80, 443},
+		Primary: testDBConfig{Host: "primary", Port: 3306},
+		Replica: &testDBConfig{Host: "replica", Port: 3306, ReadOnly: true},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadEnv() = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoadEnv_AggregatesErrors(t *testing.T) {
+	t.Setenv("TEST_LOAD_WORKERS", "ten")
+	t.Setenv("TEST_LOAD_TIMEOUT", "soon")
+	t.Setenv("TEST_LOAD_PORTS", "80;http")
+	t.Setenv("TEST_LOAD_REPLICA_HOST", "replica")
+
+	var cfg testConfig
+	err := LoadEnv(&cfg)
+	if err == nil {
+		t.Fatal("LoadEnv() expected an error")
+	}
+
+	for _, key := range []string{"TEST_LOAD_WORKERS", "TEST_LOAD_TIMEOUT", "TEST_LOAD_PORTS", "TEST_LOAD_PRIMARY_HOST"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("LoadEnv() error %q does not mention %s", err, key)
+		}
+	}
+	if !errors.Is(err, ErrMissingEnv) {
+		t.Errorf("LoadEnv() error should wrap ErrMissingEnv")
+	}
+
+	var varErr *EnvVarError
+	if !errors.As(err, &varErr) {
+		t.Errorf("LoadEnv() error should contain an *EnvVarError")
+	}
+}
+
+func TestLoadEnv_RequiredWithDefault(t *testing.T) {
+	t.Setenv("TEST_LOAD_CONFLICT", "set")
+
+	var cfg struct {
+		Missing string `env:"TEST_LOAD_CONFLICT_MISSING" required:"true" default:"x"`
+		Set     string `env:"TEST_LOAD_CONFLICT" required:"true" default:"x"`
+		Name    string `env:"TEST_LOAD_NAME" required:"false" default:"svc"`
+	}
+	err := LoadEnv(&cfg)
+	if !errors.Is(err, ErrRequiredWithDefault) {
+		t.Fatalf("LoadEnv() error = %v, want ErrRequiredWithDefault", err)
+	}
+	for _, key := range []string{"TEST_LOAD_CONFLICT_MISSING", "TEST_LOAD_CONFLICT:"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("LoadEnv() error %q does not mention %s", err, key)
+		}
+	}
+	if strings.Contains(err.Error(), "TEST_LOAD_NAME") {
+		t.Errorf("LoadEnv() error %q should not mention TEST_LOAD_NAME", err)
+	}
+	if cfg.Missing != "" || cfg.Set != "" {
+		t.Errorf("conflicting fields should be left unset, got %+v", cfg)
+	}
+	if cfg.Name != "svc" {
+		t.Errorf("Name = %q, want %q", cfg.Name, "svc")
+	}
+}
+
+type testNode struct {
+	Name  string    `env:"TEST_LOAD_NODE_NAME"`
+	Next  *testNode `prefix:"NEXT_"`
+	Other *testNode
+}
+
+func TestLoadEnv_RecursiveType(t *testing.T) {
+	t.Setenv("TEST_LOAD_NODE_NAME", "root")
+
+	var n testNode
+	if err := LoadEnv(&n); err != nil {
+		t.Fatalf("LoadEnv() error = %v", err)
+	}
+	if n.Name != "root" || n.Next != nil || n.Other != nil {
+		t.Errorf("LoadEnv() = %+v, want only Name set", n)
+	}
+}
+
+func TestLoadEnv_NilPointers(t *testing.T) {
+	type client struct{ Timeout time.Duration }
+	var cfg struct {
+		Name    string        `env:"TEST_LOAD_NAME" default:"svc"`
+		Replica *testDBConfig `prefix:"TEST_LOAD_REPLICA_"`
+		Client  *client
+	}
+	if err := LoadEnv(&cfg); err != nil {
+		t.Fatalf("LoadEnv() error = %v", err)
+	}
+	if cfg.Replica != nil {
+		t.Errorf("Replica = %+v, want nil when none of its variables are set", cfg.Replica)
+	}
+	if cfg.Client != nil {
+		t.Errorf("Client = %+v, want nil for a pointer without a prefix tag", cfg.Client)
+	}
+
+	existing := &client{Timeout: time.Second}
+	cfg.Client = existing
+	if err := LoadEnv(&cfg); err != nil || cfg.Client != existing {
+		t.Errorf("LoadEnv() should leave Client alone, got %+v, %v", cfg.Client, err)
+	}
+}
+
+func TestLoadEnv_InvalidTarget(t *testing.T) {
+	var cfg testConfig
+	tests := []struct {
+		name string
+		cfg  any
+	}{
+		{name: "Nil", cfg: nil},
+		{name: "Struct value", cfg: cfg},
+		{name: "Nil pointer", cfg: (*testConfig)(nil)},
+		{name: "Pointer to non-struct", cfg: new(string)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := LoadEnv(tt.cfg); err == nil {
+				t.Errorf("LoadEnv(%T) expected an error", tt.cfg)
+			}
+		})
+	}
+}
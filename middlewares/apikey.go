@@ -0,0 +1,247 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyPrefix starts every generated API key, so an AuthServiceFunc that
+// accepts both user tokens and API keys can tell them apart.
+const APIKeyPrefix = "ak_"
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a service credential. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID      string
+	Service string
+	Hash    string
+	Scopes  []string
+	// ExpiresAt is zero for keys that do not expire. Rotation sets it on the
+	// old key so both keys are valid during the overlap.
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// KeyStore persists API keys.
+type KeyStore interface {
+	// Create stores a new key.
+	Create(ctx context.Context, key *APIKey) error
+	// Get returns the key with the given ID, or ErrAPIKeyNotFound.
+	Get(ctx context.Context, id string) (*APIKey, error)
+	// FindByHash returns the key with the given hash, or ErrAPIKeyNotFound.
+	FindByHash(ctx context.Context, hash string) (*APIKey, error)
+	// SetExpiry changes when a key expires.
+	SetExpiry(ctx context.Context, id string, expiresAt time.Time) error
+	// TouchLastUsed records that a key was used at the given time.
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+// HashAPIKey returns the hex SHA-256 hash under which key is stored. API keys
+// carry 256 bits of entropy, so a fast hash is sufficient.
+func HashAPIKey(key string) string {
+	return HashToken(key)
+}
+
+// GenerateAPIKey creates a key for service with the given scopes and stores
+// it. The plaintext key is returned once and cannot be recovered later. A
+// zero ttl means the key does not expire.
+func GenerateAPIKey(ctx context.Context, store KeyStore, service string, scopes []string, ttl time.Duration) (string, *APIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	plaintext := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	now := time.Now()
+	key := &APIKey{
+		ID:        hex.EncodeToString(id),
+		Service:   service,
+		Hash:      HashAPIKey(plaintext),
+		Scopes:    append([]string(nil), scopes...),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		key.ExpiresAt = now.Add(ttl)
+	}
+	if err := store.Create(ctx, key); err != nil {
+		return "", nil, fmt.Errorf("failed to store api key: %w", err)
+	}
+	return plaintext, key, nil
+}
+
+// RotateAPIKey issues a replacement for key id with the same service, scopes
+// and lifetime, and lets the old key expire after overlap so callers can
+// switch over without downtime.
+func RotateAPIKey(ctx context.Context, store KeyStore, id string, overlap time.Duration) (string, *APIKey, error) {
+	old, err := store.Get(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	var ttl time.Duration
+	if !old.ExpiresAt.IsZero() {
+		ttl = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+	plaintext, key, err := GenerateAPIKey(ctx, store, old.Service, old.Scopes, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	expiresAt := time.Now().Add(overlap)
+	if old.ExpiresAt.IsZero() || expiresAt.Before(old.ExpiresAt) {
+		if err := store.SetExpiry(ctx, old.ID, expiresAt); err != nil {
+			return "", nil, fmt.Errorf("failed to expire rotated api key: %w", err)
+		}
+	}
+	return plaintext, key, nil
+}
+
+// APIKeyConfig configures APIKeyAuthService.
+type APIKeyConfig struct {
+	Store KeyStore
+	// ScopeRoles maps scopes onto User.Roles. Scopes without an entry are
+	// used as roles unchanged.
+	ScopeRoles map[string][]string
+	// LastUsedInterval throttles last-used updates per key; defaults to one
+	// minute.
+	LastUsedInterval time.Duration
+	// Now returns the current time; defaults to time.Now.
+	Now func() time.Time
+}
+
+// APIKeyAuthService authenticates API keys against cfg.Store. The returned
+// user is the service principal: ID is the service name, Uuid the key ID and
+// IsService is set. Store failures other than ErrAPIKeyNotFound are wrapped
+// in ErrAuthUnavailable.
+func APIKeyAuthService(cfg APIKeyConfig) ContextAuthServiceFunc {
+	if cfg.LastUsedInterval <= 0 {
+		cfg.LastUsedInterval = time.Minute
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	return func(ctx context.Context, token string) (*User, error) {
+		if !strings.HasPrefix(token, APIKeyPrefix) {
+			return nil, ErrTokenMalformed
+		}
+		key, err := cfg.Store.FindByHash(ctx, HashAPIKey(token))
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrAuthUnavailable, err)
+		}
+
+		now := cfg.Now()
+		if !key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt) {
+			return nil, fmt.Errorf("api key %s: %w", key.ID, ErrTokenExpired)
+		}
+		if now.Sub(key.LastUsedAt) >= cfg.LastUsedInterval {
+			// Failing to record usage must not fail the request.
+			_ = cfg.Store.TouchLastUsed(ctx, key.ID, now)
+		}
+
+		var roles []string
+		for _, scope := range key.Scopes {
+			if mapped, ok := cfg.ScopeRoles[scope]; ok {
+				roles = append(roles, mapped...)
+			} else {
+				roles = append(roles, scope)
+			}
+		}
+		return &User{ID: key.Service, Uuid: key.ID, Roles: roles, IsService: true}, nil
+	}
+}
+
+// APIKeyMiddleware authenticates requests carrying an API key in X-API-Key
+// or "Authorization: ApiKey <key>".
+func APIKeyMiddleware(cfg APIKeyConfig) Middleware {
+	return AuthMiddlewareWithConfig(AuthConfig{
+		ContextAuthService: APIKeyAuthService(cfg),
+		Extractor:          APIKeyToken(""),
+	})
+}
+
+// MemoryKeyStore is an in-memory KeyStore for tests and single-instance
+// services.
+type MemoryKeyStore struct {
+	mu     sync.RWMutex
+	byID   map[string]*APIKey
+	byHash map[string]*APIKey
+}
+
+// NewMemoryKeyStore creates an empty MemoryKeyStore.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{byID: make(map[string]*APIKey), byHash: make(map[string]*APIKey)}
+}
+
+func (s *MemoryKeyStore) Create(_ context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[key.ID]; ok {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+	stored := cloneAPIKey(key)
+	s.byID[key.ID] = stored
+	s.byHash[key.Hash] = stored
+	return nil
+}
+
+func (s *MemoryKeyStore) Get(_ context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.byID[id]; ok {
+		return cloneAPIKey(key), nil
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (s *MemoryKeyStore) FindByHash(_ context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if key, ok := s.byHash[hash]; ok {
+		return cloneAPIKey(key), nil
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (s *MemoryKeyStore) SetExpiry(_ context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.ExpiresAt = expiresAt
+	return nil
+}
+
+func (s *MemoryKeyStore) TouchLastUsed(_ context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.byID[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = at
+	return nil
+}
+
+func cloneAPIKey(k *APIKey) *APIKey {
+	c := *k
+	c.Scopes = append([]string(nil), k.Scopes...)
+	return &c
+}
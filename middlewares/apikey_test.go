@@ -0,0 +1,153 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyAuthService(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	plaintext, key, err := GenerateAPIKey(ctx, store, "billing-job", []string{"invoices:write", "reports"}, 0)
+	require.NoError(t, err)
+
+	assert.NotContains(t, key.Hash, plaintext)
+	assert.Equal(t, HashAPIKey(plaintext), key.Hash)
+
+	clock := &fakeClock{now: time.Now()}
+	authService := APIKeyAuthService(APIKeyConfig{
+		Store:      store,
+		ScopeRoles: map[string][]string{"invoices:write": {"invoice-writer", "invoice-reader"}},
+		Now:        clock.Now,
+	})
+
+	user, err := authService(ctx, plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, "billing-job", user.ID)
+	assert.Equal(t, key.ID, user.Uuid)
+	assert.True(t, user.IsService)
+	assert.Equal(t, []string{"invoice-writer", "invoice-reader", "reports"}, user.Roles)
+
+	t.Run("Last used is throttled", func(t *testing.T) {
+		stored, err := store.Get(ctx, key.ID)
+		require.NoError(t, err)
+		firstUse := stored.LastUsedAt
+		assert.Equal(t, clock.now, firstUse)
+
+		clock.Advance(10 * time.Second)
+		_, err = authService(ctx, plaintext)
+		require.NoError(t, err)
+		stored, _ = store.Get(ctx, key.ID)
+		assert.Equal(t, firstUse, stored.LastUsedAt)
+
+		clock.Advance(time.Minute)
+		_, err = authService(ctx, plaintext)
+		require.NoError(t, err)
+		stored, _ = store.Get(ctx, key.ID)
+		assert.Equal(t, clock.now, stored.LastUsedAt)
+	})
+
+	t.Run("Unknown key", func(t *testing.T) {
+		_, err := authService(ctx, APIKeyPrefix+"unknown")
+		assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	})
+
+	t.Run("Not an API key", func(t *testing.T) {
+		_, err := authService(ctx, "eyJhbGciOi...")
+		assert.ErrorIs(t, err, ErrTokenMalformed)
+	})
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	oldPlaintext, oldKey, err := GenerateAPIKey(ctx, store, "sync-job", []string{"sync"}, 0)
+	require.NoError(t, err)
+
+	newPlaintext, newKey, err := RotateAPIKey(ctx, store, oldKey.ID, time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKey.ID, newKey.ID)
+	assert.Equal(t, []string{"sync"}, newKey.Scopes)
+	assert.True(t, newKey.ExpiresAt.IsZero())
+
+	clock := &fakeClock{now: time.Now()}
+	authService := APIKeyAuthService(APIKeyConfig{Store: store, Now: clock.Now})
+
+	_, err = authService(ctx, oldPlaintext)
+	assert.NoError(t, err, "old key is valid during the overlap")
+	_, err = authService(ctx, newPlaintext)
+	assert.NoError(t, err)
+
+	clock.Advance(2 * time.Hour)
+	_, err = authService(ctx, oldPlaintext)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+	_, err = authService(ctx, newPlaintext)
+	assert.NoError(t, err)
+
+	_, _, err = RotateAPIKey(ctx, store, "missing", time.Hour)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	store := NewMemoryKeyStore()
+	plaintext, _, err := GenerateAPIKey(context.Background(), store, "report-job", []string{"reports"}, time.Hour)
+	require.NoError(t, err)
+
+	handler := APIKeyMiddleware(APIKeyConfig{Store: store})(RequireRoles("reports")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := GetUser(r.Context())
+		assert.True(t, user.IsService)
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest("GET", "/reports", http.NoBody)
+	req.Header.Set("X-API-Key", plaintext)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/reports", http.NoBody)
+	req.Header.Set("X-API-Key", plaintext+"x")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// failingKeyStore fails every lookup and remembers the context it got.
+type failingKeyStore struct {
+	*MemoryKeyStore
+	ctx context.Context
+}
+
+func (s *failingKeyStore) FindByHash(ctx context.Context, _ string) (*APIKey, error) {
+	s.ctx = ctx
+	return nil, errors.New("connection refused")
+}
+
+func TestAPIKeyMiddleware_StoreFailure(t *testing.T) {
+	store := &failingKeyStore{MemoryKeyStore: NewMemoryKeyStore()}
+	handler := APIKeyMiddleware(APIKeyConfig{Store: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	type ctxKey struct{}
+	req := httptest.NewRequest("GET", "/reports", http.NoBody)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "request"))
+	req.Header.Set("X-API-Key", APIKeyPrefix+"anything")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), AuthErrUnavailable)
+	require.NotNil(t, store.ctx)
+	assert.Equal(t, "request", store.ctx.Value(ctxKey{}), "the store gets the request context")
+
+	_, err := APIKeyAuthService(APIKeyConfig{Store: store})(context.Background(), APIKeyPrefix+"anything")
+	assert.ErrorIs(t, err, ErrAuthUnavailable)
+}
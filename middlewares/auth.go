@@ -2,10 +2,14 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/salahfarzin/utils/rest"
+	"github.com/salahfarzin/utils/tracing"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -23,6 +27,17 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Avatar    *string   `json:"avatar"`
+	// IsService marks service principals, such as callers authenticated by
+	// API key, as opposed to end users.
+	IsService bool `json:"is_service,omitempty"`
+	// TenantID is the tenant the user belongs to, if any.
+	TenantID string `json:"tenant_id,omitempty"`
+	// IssuedAt is when the token was issued (the JWT iat claim), if known.
+	// RevocationStore.RevokeUser only rejects tokens issued before it.
+	IssuedAt time.Time `json:"issued_at,omitzero"`
+	// ExpiresAt is when the token expires (the JWT exp claim), if known.
+	// CachedAuthService never keeps the user past it.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
 }
 
 // Context key for user info
@@ -37,21 +52,101 @@ func GetUser(ctx context.Context) (*User, bool) {
 // AuthServiceFunc checks token and returns user info (mock signature)
 type AuthServiceFunc func(token string) (*User, error)
 
+// ContextAuthServiceFunc is an AuthServiceFunc that receives the request
+// context, so lookups are cancelled with the request.
+type ContextAuthServiceFunc func(ctx context.Context, token string) (*User, error)
+
+// ErrAuthUnavailable is wrapped by auth services that could not check a
+// token, e.g. because their store is down. AuthMiddleware answers 503 and
+// the gRPC interceptors codes.Unavailable instead of rejecting the token.
+var ErrAuthUnavailable = errors.New("authentication unavailable")
+
+// Error codes of AuthMiddleware responses.
+const (
+	AuthErrMissingToken   = "missing_token"
+	AuthErrInvalidToken   = "invalid_token"
+	AuthErrTokenExpired   = "token_expired"
+	AuthErrTokenMalformed = "token_malformed"
+	AuthErrTokenRevoked   = "token_revoked"
+	AuthErrUserInactive   = "user_inactive"
+	AuthErrUnavailable    = "auth_unavailable"
+)
+
+// AuthConfig configures AuthMiddlewareWithConfig.
+type AuthConfig struct {
+	AuthService AuthServiceFunc
+	// ContextAuthService is used instead of AuthService when set.
+	ContextAuthService ContextAuthServiceFunc
+	// Extractor finds the token in the request; defaults to
+	// DefaultTokenExtractor.
+	Extractor TokenExtractor
+	// Optional lets requests without a token through anonymously. Requests
+	// with an invalid token are still rejected.
+	Optional bool
+	// Realm is reported in WWW-Authenticate challenges.
+	Realm string
+	// Revocations, if set, is consulted after the token was validated.
+	// Users whose IsActive is false are rejected regardless.
+	Revocations RevocationStore
+}
+
 // AuthMiddleware validates access_token and injects user info into context
 func AuthMiddleware(authService AuthServiceFunc) Middleware {
+	return AuthMiddlewareWithConfig(AuthConfig{AuthService: authService})
+}
+
+// OptionalAuth is AuthMiddleware for routes that also serve anonymous users:
+// the user is attached when a valid token is present.
+func OptionalAuth(authService AuthServiceFunc) Middleware {
+	return AuthMiddlewareWithConfig(AuthConfig{AuthService: authService, Optional: true})
+}
+
+// AuthMiddlewareWithConfig is AuthMiddleware with a configurable token
+// extractor, so each route can accept the credentials it needs:
+//
+//	ws := AuthMiddlewareWithConfig(AuthConfig{
+//		AuthService: authService,
+//		Extractor:   ChainExtractors(BearerToken(), QueryToken("access_token")),
+//	})
+//
+// Failures are written with rest.WriteJSONErrorCode using one of the
+// AuthErr* codes, along with a WWW-Authenticate challenge.
+func AuthMiddlewareWithConfig(cfg AuthConfig) Middleware {
+	authService := cfg.ContextAuthService
+	if authService == nil {
+		authService = cfg.AuthService.withContext()
+	}
+	extract := cfg.Extractor
+	if extract == nil {
+		extract = DefaultTokenExtractor
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token := ExtractToken(r)
+			token := extract(r)
 			if token == "" {
-				http.Error(w, "missing access token", http.StatusUnauthorized)
+				if cfg.Optional {
+					stripIdentityHeaders(r)
+					next.ServeHTTP(w, r)
+					return
+				}
+				cfg.writeError(w, r, AuthErrMissingToken, "missing access token")
 				return
 			}
 
-			user, err := authService(token)
+			user, err := authService(r.Context(), token)
+			if err == nil && user == nil {
+				err = errNoUser
+			}
+			if err == nil {
+				err = checkUser(r.Context(), cfg.Revocations, token, user)
+			}
 			if err != nil {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				http.Error(w, `{"Code": 401, "message": "invalid access token"}`, http.StatusUnauthorized)
+				code, msg := classifyAuthError(err)
+				if code == AuthErrUnavailable {
+					rest.WriteJSONErrorCode(w, http.StatusServiceUnavailable, code, msg, tracing.GetTraceIDFromContext(r.Context()))
+					return
+				}
+				cfg.writeError(w, r, code, msg)
 				return
 			}
 
@@ -59,27 +154,66 @@ func AuthMiddleware(authService AuthServiceFunc) Middleware {
 			ctx := context.WithValue(r.Context(), UserKey, user)
 
 			// Set headers for gRPC-Gateway to forward as metadata
-			r.Header.Set("x-user-id", user.ID)
-			r.Header.Set("x-user-uuid", user.Uuid)
-			r.Header.Set("x-user-roles", strings.Join(user.Roles, ","))
+			setIdentityHeaders(r, user)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-func ExtractToken(r *http.Request) string {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader != "" && len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		return authHeader[7:]
+// withContext adapts f to a ContextAuthServiceFunc that ignores the context.
+func (f AuthServiceFunc) withContext() ContextAuthServiceFunc {
+	if f == nil {
+		return nil
 	}
-	if cookie, err := r.Cookie("access_token"); err == nil {
-		return cookie.Value
+	return func(_ context.Context, token string) (*User, error) {
+		return f(token)
 	}
-	return ""
 }
 
-// GetUserFromContext tries to extract user info and roles from context or gRPC metadata
+func classifyAuthError(err error) (code, msg string) {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return AuthErrTokenExpired, "access token expired"
+	case errors.Is(err, ErrTokenMalformed):
+		return AuthErrTokenMalformed, "malformed access token"
+	case errors.Is(err, ErrTokenRevoked):
+		return AuthErrTokenRevoked, "access token revoked"
+	case errors.Is(err, ErrUserInactive):
+		return AuthErrUserInactive, "user account is inactive"
+	case errors.Is(err, ErrAuthUnavailable), errors.Is(err, errRevocationCheck):
+		return AuthErrUnavailable, "authentication temporarily unavailable"
+	}
+	return AuthErrInvalidToken, "invalid access token"
+}
+
+// writeError sends a 401 with an RFC 6750 challenge. Requests without
+// credentials get a bare challenge; the others get error="invalid_token".
+func (cfg AuthConfig) writeError(w http.ResponseWriter, r *http.Request, code, msg string) {
+	var params []string
+	if cfg.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", cfg.Realm))
+	}
+	if code != AuthErrMissingToken {
+		params = append(params, `error="invalid_token"`, fmt.Sprintf("error_description=%q", msg))
+	}
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	rest.WriteJSONErrorCode(w, http.StatusUnauthorized, code, msg, tracing.GetTraceIDFromContext(r.Context()))
+}
+
+// ExtractToken returns the token found by DefaultTokenExtractor.
+func ExtractToken(r *http.Request) string {
+	return DefaultTokenExtractor(r)
+}
+
+// GetUserFromContext tries to extract user info and roles from context or gRPC metadata.
+// Metadata is trusted only if it carries an x-user-assertion signed with the key set by
+// SetIdentityKey. Without a key it is ignored, unless SetTrustUnsignedIdentity opts into
+// the insecure plain x-user-* fields.
 func GetUserFromContext(ctx context.Context) User {
 	// Try context first (HTTP)
 	if user, ok := GetUser(ctx); ok && user != nil {
@@ -87,6 +221,20 @@ func GetUserFromContext(ctx context.Context) User {
 	}
 	// Try gRPC metadata (gRPC-Gateway)
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if key := currentIdentityKey(); key != nil {
+			var assertion string
+			if vals := md.Get(UserAssertionHeader); len(vals) > 0 {
+				assertion = vals[0]
+			}
+			if user, err := VerifyUserAssertion(key, assertion, time.Now()); err == nil {
+				return *user
+			}
+			return User{}
+		}
+		if !trustUnsignedIdentity() {
+			return User{}
+		}
+
 		// Try x-user-id, x-user-uuid, x-user-roles (string fields)
 		id := ""
 		uuid := ""
@@ -114,8 +262,12 @@ func GetUserFromContext(ctx context.Context) User {
 }
 
 // TestAuthMiddleware is a simplified auth middleware for E2E testing
-// It extracts user info from headers without calling an external auth service
+// It extracts user info from headers without calling an external auth service.
+// It panics unless TestAuthEnabled.
+//
+// Deprecated: Use FixtureAuthMiddleware, which authenticates as complete users.
 func TestAuthMiddleware() Middleware {
+	mustAllowTestAuth()
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Extract user info from test headers
@@ -141,9 +293,7 @@ func TestAuthMiddleware() Middleware {
 			ctx := context.WithValue(r.Context(), UserKey, user)
 
 			// Set headers for gRPC-Gateway to forward as metadata
-			r.Header.Set("x-user-id", user.ID)
-			r.Header.Set("x-user-uuid", user.Uuid)
-			r.Header.Set("x-user-roles", strings.Join(user.Roles, ","))
+			setIdentityHeaders(r, user)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
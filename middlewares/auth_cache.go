@@ -0,0 +1,212 @@
+package middlewares
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errAuthServicePanicked = errors.New("auth service panicked")
+
+// AuthCacheConfig configures CachedAuthService.
+type AuthCacheConfig struct {
+	// TTL is how long a successful lookup is reused. An entry never outlives
+	// the token: it is dropped at User.ExpiresAt or, when that is unset, at
+	// the exp claim of a JWT token.
+	TTL time.Duration
+	// NegativeTTL is how long a failed lookup is reused; zero disables
+	// negative caching. It should be shorter than TTL. Errors wrapping
+	// ErrAuthUnavailable or a context error are never cached, so an outage
+	// of the auth service does not outlast itself.
+	NegativeTTL time.Duration
+	// MaxEntries bounds the cache; the least recently used entry is evicted
+	// first. Zero means 10000.
+	MaxEntries int
+	// Now returns the current time; defaults to time.Now.
+	Now func() time.Time
+}
+
+// CachedAuthService wraps authService with an in-memory LRU cache. Concurrent
+// lookups of the same token share a single call, and tokens are stored only
+// as SHA-256 hashes. Callers receive copies of the cached User, so they may
+// modify it freely.
+func CachedAuthService(authService AuthServiceFunc, cfg AuthCacheConfig) AuthServiceFunc {
+	c := newAuthCache(authService, cfg)
+	return c.lookup
+}
+
+type tokenHash [sha256.Size]byte
+
+type authCacheEntry struct {
+	key     tokenHash
+	user    *User
+	err     error
+	expires time.Time
+}
+
+type authCall struct {
+	wg   sync.WaitGroup
+	user *User
+	err  error
+}
+
+type authCache struct {
+	authService AuthServiceFunc
+	cfg         AuthCacheConfig
+
+	mu       sync.Mutex
+	entries  map[tokenHash]*list.Element
+	lru      *list.List
+	inflight map[tokenHash]*authCall
+}
+
+func newAuthCache(authService AuthServiceFunc, cfg AuthCacheConfig) *authCache {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 10000
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &authCache{
+		authService: authService,
+		cfg:         cfg,
+		entries:     make(map[tokenHash]*list.Element),
+		lru:         list.New(),
+		inflight:    make(map[tokenHash]*authCall),
+	}
+}
+
+func (c *authCache) lookup(token string) (*User, error) {
+	key := tokenHash(sha256.Sum256([]byte(token)))
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*authCacheEntry)
+		if c.cfg.Now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			return cloneUser(entry.user), entry.err
+		}
+		c.remove(el)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return cloneUser(call.user), call.err
+	}
+	call := &authCall{}
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	c.call(key, token, call)
+	return cloneUser(call.user), call.err
+}
+
+// call runs the lookup for the waiters of call. If authService panics, the
+// waiters are released and nothing is cached.
+func (c *authCache) call(key tokenHash, token string, call *authCall) {
+	completed := false
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if completed {
+			c.store(key, token, call.user, call.err)
+		} else {
+			call.err = errAuthServicePanicked
+		}
+		c.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.user, call.err = c.authService(token)
+	completed = true
+}
+
+// store caches a result. Callers must hold c.mu.
+func (c *authCache) store(key tokenHash, token string, user *User, err error) {
+	ttl := c.cfg.TTL
+	if err != nil {
+		ttl = c.cfg.NegativeTTL
+		if errors.Is(err, ErrAuthUnavailable) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	now := c.cfg.Now()
+	expires := now.Add(ttl)
+	if exp := tokenExpiry(token, user); !exp.IsZero() && exp.Before(expires) {
+		expires = exp
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	entry := &authCacheEntry{key: key, user: user, err: err, expires: expires}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.cfg.MaxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// tokenExpiry returns when the token expires: user.ExpiresAt if set,
+// otherwise the exp claim if the token is a JWT. The claim is read without
+// verification; it can only shorten how long an entry is kept.
+func tokenExpiry(token string, user *User) time.Time {
+	if user != nil && !user.ExpiresAt.IsZero() {
+		return user.ExpiresAt
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	var claims map[string]any
+	if decodeJWTSegment(parts[1], &claims) != nil {
+		return time.Time{}
+	}
+	exp, _, _ := numericClaim(claims, "exp")
+	return exp
+}
+
+// remove drops an entry. Callers must hold c.mu.
+func (c *authCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*authCacheEntry).key)
+}
+
+// cloneUser returns a copy of u that shares no mutable state with it.
+func cloneUser(u *User) *User {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	c.Roles = append([]string(nil), u.Roles...)
+	c.IsActive = clonePtr(u.IsActive)
+	c.Mobile = clonePtr(u.Mobile)
+	c.FirstName = clonePtr(u.FirstName)
+	c.LastName = clonePtr(u.LastName)
+	c.Gender = clonePtr(u.Gender)
+	c.Birthdate = clonePtr(u.Birthdate)
+	c.Avatar = clonePtr(u.Avatar)
+	return &c
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
@@ -0,0 +1,221 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type countingAuthService struct {
+	calls atomic.Int32
+}
+
+func (s *countingAuthService) auth(token string) (*User, error) {
+	s.calls.Add(1)
+	if token == "invalid" {
+		return nil, errors.New("invalid token")
+	}
+	return &User{ID: token, Roles: []string{"user"}}, nil
+}
+
+func TestCachedAuthService_TTL(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	svc := &countingAuthService{}
+	cached := CachedAuthService(svc.auth, AuthCacheConfig{TTL: time.Minute, NegativeTTL: 5 * time.Second, Now: clock.Now})
+
+	for i := 0; i < 3; i++ {
+		user, err := cached("token-a")
+		require.NoError(t, err)
+		assert.Equal(t, "token-a", user.ID)
+	}
+	assert.Equal(t, int32(1), svc.calls.Load())
+
+	for i := 0; i < 3; i++ {
+		_, err := cached("invalid")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(2), svc.calls.Load(), "failures should be cached")
+
+	clock.Advance(10 * time.Second)
+	_, _ = cached("invalid")
+	_, _ = cached("token-a")
+	assert.Equal(t, int32(3), svc.calls.Load(), "negative entries should expire first")
+
+	clock.Advance(time.Minute)
+	_, _ = cached("token-a")
+	assert.Equal(t, int32(4), svc.calls.Load())
+}
+
+func TestCachedAuthService_TokenExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	var calls atomic.Int32
+	cached := CachedAuthService(func(token string) (*User, error) {
+		calls.Add(1)
+		user := &User{ID: "user-1"}
+		if token == "opaque" {
+			user.ExpiresAt = clock.Now().Add(10 * time.Second)
+		}
+		return user, nil
+	}, AuthCacheConfig{TTL: time.Minute, Now: clock.Now})
+
+	payload := base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, `{"sub":"user-1","exp":%d}`, clock.Now().Add(20*time.Second).Unix()))
+	jwt := "header." + payload + ".sig"
+	expired := "header." + base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, `{"exp":%d}`, clock.Now().Unix())) + ".sig"
+
+	_, _ = cached("opaque")
+	_, _ = cached(jwt)
+	_, _ = cached(expired)
+	_, _ = cached("opaque")
+	_, _ = cached(jwt)
+	_, _ = cached(expired)
+	assert.Equal(t, int32(4), calls.Load(), "an already expired token should not be cached")
+
+	clock.Advance(10 * time.Second)
+	_, _ = cached("opaque")
+	_, _ = cached(jwt)
+	assert.Equal(t, int32(5), calls.Load(), "User.ExpiresAt should cap the TTL")
+
+	clock.Advance(10 * time.Second)
+	_, _ = cached(jwt)
+	assert.Equal(t, int32(6), calls.Load(), "the JWT exp claim should cap the TTL")
+}
+
+func TestCachedAuthService_NoNegativeCaching(t *testing.T) {
+	svc := &countingAuthService{}
+	cached := CachedAuthService(svc.auth, AuthCacheConfig{TTL: time.Minute})
+
+	_, _ = cached("invalid")
+	_, _ = cached("invalid")
+	assert.Equal(t, int32(2), svc.calls.Load())
+}
+
+func TestCachedAuthService_TransientErrors(t *testing.T) {
+	for _, failure := range []error{
+		fmt.Errorf("%w: status 503", ErrAuthUnavailable),
+		context.DeadlineExceeded,
+		fmt.Errorf("auth request: %w", context.Canceled),
+	} {
+		var calls atomic.Int32
+		cached := CachedAuthService(func(token string) (*User, error) {
+			if calls.Add(1) == 1 {
+				return nil, failure
+			}
+			return &User{ID: token}, nil
+		}, AuthCacheConfig{TTL: time.Minute, NegativeTTL: time.Minute})
+
+		_, err := cached("token")
+		assert.ErrorIs(t, err, failure)
+		user, err := cached("token")
+		require.NoError(t, err, "%v should not be cached", failure)
+		assert.Equal(t, "token", user.ID)
+		assert.Equal(t, int32(2), calls.Load())
+	}
+}
+
+func TestCachedAuthService_LRU(t *testing.T) {
+	svc := &countingAuthService{}
+	cached := CachedAuthService(svc.auth, AuthCacheConfig{TTL: time.Minute, MaxEntries: 2})
+
+	_, _ = cached("a")
+	_, _ = cached("b")
+	_, _ = cached("a") // a is now most recently used
+	_, _ = cached("c") // evicts b
+	assert.Equal(t, int32(3), svc.calls.Load())
+
+	_, _ = cached("a")
+	assert.Equal(t, int32(3), svc.calls.Load())
+	_, _ = cached("b")
+	assert.Equal(t, int32(4), svc.calls.Load())
+}
+
+func TestCachedAuthService_Singleflight(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	cached := CachedAuthService(func(token string) (*User, error) {
+		calls.Add(1)
+		<-release
+		return &User{ID: token}, nil
+	}, AuthCacheConfig{TTL: time.Minute})
+
+	var wg sync.WaitGroup
+	users := make([]*User, 10)
+	for i := range users {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			users[i], _ = cached("shared")
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for i, u := range users {
+		require.NotNil(t, u, "user %d", i)
+		assert.Equal(t, "shared", u.ID)
+	}
+}
+
+func TestCachedAuthService_ReturnsCopies(t *testing.T) {
+	svc := &countingAuthService{}
+	cached := CachedAuthService(svc.auth, AuthCacheConfig{TTL: time.Minute})
+
+	first, _ := cached("token")
+	first.Roles[0] = "admin"
+	first.ID = "changed"
+
+	second, _ := cached("token")
+	assert.Equal(t, "token", second.ID)
+	assert.Equal(t, []string{"user"}, second.Roles)
+}
+
+func TestCachedAuthService_HashedKeys(t *testing.T) {
+	svc := &countingAuthService{}
+	c := newAuthCache(svc.auth, AuthCacheConfig{TTL: time.Minute})
+	_, _ = c.lookup("raw-secret-token")
+
+	for key := range c.entries {
+		assert.NotContains(t, fmt.Sprintf("%s", key[:]), "raw-secret-token")
+	}
+}
+
+func TestCachedAuthService_Panic(t *testing.T) {
+	var calls atomic.Int32
+	cached := CachedAuthService(func(token string) (*User, error) {
+		if calls.Add(1) == 1 {
+			panic("boom")
+		}
+		return &User{ID: token}, nil
+	}, AuthCacheConfig{TTL: time.Minute})
+
+	assert.Panics(t, func() { _, _ = cached("token") })
+	user, err := cached("token")
+	require.NoError(t, err)
+	assert.Equal(t, "token", user.ID)
+}
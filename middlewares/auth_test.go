@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/salahfarzin/utils/rest"
+	"github.com/salahfarzin/utils/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware_ErrorResponses(t *testing.T) {
+	authService := func(token string) (*User, error) {
+		switch token {
+		case "expired":
+			return nil, fmt.Errorf("verify: %w", ErrTokenExpired)
+		case "malformed":
+			return nil, ErrTokenMalformed
+		case "revoked":
+			return nil, ErrTokenRevoked
+		case "nil-user":
+			return nil, nil
+		}
+		return nil, errors.New("unknown token")
+	}
+	handler := AuthMiddlewareWithConfig(AuthConfig{AuthService: authService, Realm: "api"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called")
+	}))
+
+	tests := []struct {
+		name      string
+		token     string
+		code      string
+		challenge string
+	}{
+		{name: "Missing", token: "", code: AuthErrMissingToken, challenge: `Bearer realm="api"`},
+		{name: "Expired", token: "expired", code: AuthErrTokenExpired, challenge: `Bearer realm="api", error="invalid_token", error_description="access token expired"`},
+		{name: "Malformed", token: "malformed", code: AuthErrTokenMalformed, challenge: `Bearer realm="api", error="invalid_token", error_description="malformed access token"`},
+		{name: "Revoked", token: "revoked", code: AuthErrTokenRevoked, challenge: `Bearer realm="api", error="invalid_token", error_description="access token revoked"`},
+		{name: "Invalid", token: "other", code: AuthErrInvalidToken, challenge: `Bearer realm="api", error="invalid_token", error_description="invalid access token"`},
+		{name: "No user", token: "nil-user", code: AuthErrInvalidToken, challenge: `Bearer realm="api", error="invalid_token", error_description="invalid access token"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", http.NoBody)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			req = req.WithContext(tracing.InjectTraceIDToContext(req.Context(), "trace-123"))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.challenge, w.Header().Get("WWW-Authenticate"))
+
+			var resp rest.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp), "body must be a single JSON document")
+			assert.Equal(t, tt.code, resp.Code)
+			assert.Equal(t, "trace-123", resp.TraceID)
+		})
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	authService := func(token string) (*User, error) {
+		if token == "valid-token" {
+			return &User{ID: "123"}, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+
+	var gotUser *User
+	handler := OptionalAuth(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = GetUser(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("Anonymous", func(t *testing.T) {
+		gotUser = nil
+		req := httptest.NewRequest("GET", "/test", http.NoBody)
+		req.Header.Set("X-User-Id", "999")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Nil(t, gotUser)
+		assert.Empty(t, req.Header.Get("X-User-Id"), "forged identity headers must be stripped")
+	})
+
+	t.Run("Authenticated", func(t *testing.T) {
+		gotUser = nil
+		req := httptest.NewRequest("GET", "/test", http.NoBody)
+		req.Header.Set("Authorization", "Bearer valid-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.NotNil(t, gotUser)
+		assert.Equal(t, "123", gotUser.ID)
+	})
+
+	t.Run("Invalid token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/test", http.NoBody)
+		req.Header.Set("Authorization", "Bearer bogus")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
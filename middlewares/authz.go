@@ -0,0 +1,246 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+
+	"github.com/salahfarzin/utils/rest"
+	"github.com/salahfarzin/utils/tracing"
+)
+
+// Policy decides whether an authenticated user may perform a request.
+type Policy interface {
+	Allow(r *http.Request, user *User) bool
+}
+
+// PolicyFunc adapts a function to a Policy.
+type PolicyFunc func(r *http.Request, user *User) bool
+
+func (f PolicyFunc) Allow(r *http.Request, user *User) bool {
+	return f(r, user)
+}
+
+// Authorize rejects requests the policy does not allow. It must run after
+// AuthMiddleware: requests without a user get 401, denied requests get 403.
+func Authorize(p Policy) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := GetUser(r.Context())
+			if !ok || user == nil {
+				rest.WriteJSONError(w, http.StatusUnauthorized, "authentication required", tracing.GetTraceIDFromContext(r.Context()))
+				return
+			}
+			if !p.Allow(r, user) {
+				rest.WriteJSONError(w, http.StatusForbidden, "forbidden", tracing.GetTraceIDFromContext(r.Context()))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles allows users with at least one of roles.
+func RequireRoles(roles ...string) Middleware {
+	return Authorize(AnyRole(roles...))
+}
+
+// RequireAllRoles allows users with every one of roles.
+func RequireAllRoles(roles ...string) Middleware {
+	return Authorize(AllRoles(roles...))
+}
+
+// RequirePermission allows users whose roles grant permission.
+func RequirePermission(perms RolePermissions, permission string) Middleware {
+	return Authorize(HasPermission(perms, permission))
+}
+
+// AnyRole allows users with at least one of roles.
+func AnyRole(roles ...string) Policy {
+	return PolicyFunc(func(_ *http.Request, user *User) bool {
+		return slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(user.Roles, role) })
+	})
+}
+
+// AllRoles allows users with every one of roles.
+func AllRoles(roles ...string) Policy {
+	return PolicyFunc(func(_ *http.Request, user *User) bool {
+		for _, role := range roles {
+			if !slices.Contains(user.Roles, role) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RolePermissions maps a role to the permissions it grants. The "*"
+// permission grants everything.
+type RolePermissions map[string][]string
+
+// Has reports whether any of the user's roles grants permission.
+func (rp RolePermissions) Has(user *User, permission string) bool {
+	for _, role := range user.Roles {
+		perms := rp[role]
+		if slices.Contains(perms, permission) || slices.Contains(perms, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission allows users whose roles grant permission.
+func HasPermission(perms RolePermissions, permission string) Policy {
+	return PolicyFunc(func(_ *http.Request, user *User) bool {
+		return perms.Has(user, permission)
+	})
+}
+
+// PathParamIsUser allows requests whose path parameter param (as set by
+// http.ServeMux) is the user's ID or UUID, e.g. GET /users/{id} for oneself.
+func PathParamIsUser(param string) Policy {
+	return PolicyFunc(func(r *http.Request, user *User) bool {
+		v := r.PathValue(param)
+		return v != "" && (v == user.ID || v == user.Uuid)
+	})
+}
+
+// AllOf allows a request only if every policy does.
+func AllOf(policies ...Policy) Policy {
+	return PolicyFunc(func(r *http.Request, user *User) bool {
+		for _, p := range policies {
+			if !p.Allow(r, user) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// AnyOf allows a request if at least one policy does.
+func AnyOf(policies ...Policy) Policy {
+	return PolicyFunc(func(r *http.Request, user *User) bool {
+		for _, p := range policies {
+			if p.Allow(r, user) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RouteRule binds a Policy to an http.ServeMux pattern such as
+// "DELETE /users/{id}". Path parameters are available to the policy through
+// r.PathValue.
+type RouteRule struct {
+	Pattern string
+	Policy  Policy
+}
+
+type routeDecisionKey struct{}
+
+type routeDecision struct {
+	matched bool
+	allowed bool
+}
+
+// RoutePolicy selects the policy of the rule whose pattern matches the
+// request, using http.ServeMux precedence. Paths are cleaned first, so
+// "/admin//x" and "/admin/x/../y" are checked like "/admin/x" and "/admin/y",
+// and requests ServeMux would redirect, e.g. "/admin" to "/admin/", use the
+// policy of the redirect target. Requests matching a pattern only with
+// another method are denied; requests matching no rule use fallback. Like
+// ServeMux, it panics on invalid or conflicting patterns.
+//
+//	middlewares.Authorize(middlewares.RoutePolicy(
+//		middlewares.AnyRole("user"),
+//		middlewares.RouteRule{Pattern: "DELETE /users/{id}", Policy: middlewares.AnyRole("admin")},
+//		middlewares.RouteRule{Pattern: "GET /users/{id}", Policy: middlewares.AnyOf(
+//			middlewares.AnyRole("admin"), middlewares.PathParamIsUser("id"))},
+//	))
+func RoutePolicy(fallback Policy, rules ...RouteRule) Policy {
+	mux := http.NewServeMux()
+	for _, rule := range rules {
+		policy := rule.Policy
+		mux.HandleFunc(rule.Pattern, func(_ http.ResponseWriter, r *http.Request) {
+			d := r.Context().Value(routeDecisionKey{}).(*routeDecision)
+			user, _ := GetUser(r.Context())
+			d.matched = true
+			d.allowed = user != nil && policy.Allow(r, user)
+		})
+	}
+
+	return PolicyFunc(func(r *http.Request, user *User) bool {
+		d := &routeDecision{}
+		ctx := context.WithValue(r.Context(), routeDecisionKey{}, d)
+		ctx = context.WithValue(ctx, UserKey, user)
+		req := r.WithContext(ctx)
+		req.URL = cleanedURL(r.URL, r.URL.Path)
+
+		w := &routeResponseWriter{}
+		mux.ServeHTTP(w, req)
+		if !d.matched && isRedirect(w.status) {
+			if target, err := url.Parse(w.Header().Get("Location")); err == nil && target.Path != "" {
+				req.URL = cleanedURL(r.URL, target.Path)
+				w = &routeResponseWriter{}
+				mux.ServeHTTP(w, req)
+			}
+		}
+		switch {
+		case d.matched:
+			return d.allowed
+		case w.status == http.StatusNotFound:
+			return fallback.Allow(r, user)
+		}
+		// A redirect loop or a pattern that exists for other methods only.
+		return false
+	})
+}
+
+// cleanedURL copies u with its path set to p, cleaned like ServeMux does.
+func cleanedURL(u *url.URL, p string) *url.URL {
+	clean := *u
+	if p == "" || p[0] != '/' {
+		p = "/" + p
+	}
+	np := path.Clean(p)
+	if p[len(p)-1] == '/' && np != "/" {
+		np += "/"
+	}
+	clean.Path, clean.RawPath = np, ""
+	return &clean
+}
+
+func isRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusTemporaryRedirect ||
+		status == http.StatusPermanentRedirect
+}
+
+// routeResponseWriter swallows the responses of RoutePolicy's internal mux,
+// keeping the status and headers to tell redirects, 404s and 405s apart.
+type routeResponseWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *routeResponseWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+func (w *routeResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *routeResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
@@ -0,0 +1,117 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/salahfarzin/utils/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveAs(user *User, handler http.Handler, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, http.NoBody)
+	if user != nil {
+		req = req.WithContext(context.WithValue(req.Context(), UserKey, user))
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestRequireRoles(t *testing.T) {
+	admin := &User{ID: "1", Roles: []string{"admin", "user"}}
+	user := &User{ID: "2", Roles: []string{"user"}}
+
+	anyRole := RequireRoles("admin", "editor")(okHandler)
+	allRoles := RequireAllRoles("admin", "user")(okHandler)
+
+	assert.Equal(t, http.StatusOK, serveAs(admin, anyRole, "GET", "/").Code)
+	assert.Equal(t, http.StatusForbidden, serveAs(user, anyRole, "GET", "/").Code)
+	assert.Equal(t, http.StatusOK, serveAs(admin, allRoles, "GET", "/").Code)
+	assert.Equal(t, http.StatusForbidden, serveAs(user, allRoles, "GET", "/").Code)
+
+	w := serveAs(nil, anyRole, "GET", "/")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRequirePermission(t *testing.T) {
+	perms := RolePermissions{
+		"admin":  {"*"},
+		"editor": {"posts:write", "posts:read"},
+		"viewer": {"posts:read"},
+	}
+	handler := RequirePermission(perms, "posts:write")(okHandler)
+
+	assert.Equal(t, http.StatusOK, serveAs(&User{Roles: []string{"admin"}}, handler, "POST", "/posts").Code)
+	assert.Equal(t, http.StatusOK, serveAs(&User{Roles: []string{"viewer", "editor"}}, handler, "POST", "/posts").Code)
+
+	w := serveAs(&User{Roles: []string{"viewer"}}, handler, "POST", "/posts")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var resp rest.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "forbidden", resp.Error)
+	assert.NotEmpty(t, resp.TraceID)
+}
+
+func TestRoutePolicy(t *testing.T) {
+	policy := RoutePolicy(
+		AnyRole("user"),
+		RouteRule{Pattern: "DELETE /users/{id}", Policy: AnyRole("admin")},
+		RouteRule{Pattern: "GET /users/{id}", Policy: AnyOf(AnyRole("admin"), PathParamIsUser("id"))},
+		RouteRule{Pattern: "/admin/", Policy: AllOf(AnyRole("admin"), AnyRole("staff"))},
+	)
+	handler := Authorize(policy)(okHandler)
+
+	admin := &User{ID: "1", Roles: []string{"admin", "user"}}
+	alice := &User{ID: "2", Uuid: "uuid-2", Roles: []string{"user"}}
+	guest := &User{ID: "3"}
+
+	tests := []struct {
+		name   string
+		user   *User
+		method string
+		path   string
+		want   int
+	}{
+		{name: "Admin deletes", user: admin, method: "DELETE", path: "/users/2", want: http.StatusOK},
+		{name: "User cannot delete", user: alice, method: "DELETE", path: "/users/2", want: http.StatusForbidden},
+		{name: "User reads self by ID", user: alice, method: "GET", path: "/users/2", want: http.StatusOK},
+		{name: "User reads self by UUID", user: alice, method: "GET", path: "/users/uuid-2", want: http.StatusOK},
+		{name: "User cannot read others", user: alice, method: "GET", path: "/users/1", want: http.StatusForbidden},
+		{name: "Admin without staff", user: admin, method: "GET", path: "/admin/stats", want: http.StatusForbidden},
+		{name: "Fallback allows users", user: alice, method: "GET", path: "/posts", want: http.StatusOK},
+		{name: "Fallback denies guests", user: guest, method: "GET", path: "/posts", want: http.StatusForbidden},
+		{name: "Trailing slash", user: alice, method: "GET", path: "/admin/x/", want: http.StatusForbidden},
+		{name: "Double slash", user: alice, method: "GET", path: "/admin//x", want: http.StatusForbidden},
+		{name: "Dot segments", user: alice, method: "GET", path: "/posts/../admin/x", want: http.StatusForbidden},
+		{name: "Subtree root redirect", user: alice, method: "GET", path: "/admin", want: http.StatusForbidden},
+		{name: "Clean paths still allowed", user: alice, method: "GET", path: "/posts//1/", want: http.StatusOK},
+		{name: "Other method", user: alice, method: "PUT", path: "/users/2", want: http.StatusForbidden},
+		{name: "Other method as admin", user: admin, method: "PUT", path: "/users/2", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, serveAs(tt.user, handler, tt.method, tt.path).Code)
+		})
+	}
+}
+
+func TestPathParamIsUser_WithServeMux(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /profiles/{id}", Authorize(PathParamIsUser("id"))(okHandler))
+
+	user := &User{ID: "42"}
+	assert.Equal(t, http.StatusOK, serveAs(user, mux, "GET", "/profiles/42").Code)
+	assert.Equal(t, http.StatusForbidden, serveAs(user, mux, "GET", "/profiles/7").Code)
+}
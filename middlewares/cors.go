@@ -1,28 +1,364 @@
 package middlewares
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/salahfarzin/utils/rest"
+	"github.com/salahfarzin/utils/tracing"
+	"go.uber.org/zap"
 )
 
+// ErrCORSWildcardCredentials is returned by CORSConfig.Validate when the "*"
+// origin is combined with credentials, which browsers reject.
+var ErrCORSWildcardCredentials = errors.New(`cors: the "*" origin cannot be combined with credentials`)
+
+// corsRegexPrefix marks an AllowedOrigins entry as a regular expression.
+const corsRegexPrefix = "regex:"
+
+// CORSConfig describes a CORS policy.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins that may make cross-origin requests.
+	// Besides exact origins, entries may be:
+	//
+	//	*                        any origin (not allowed with credentials)
+	//	*.example.com            any subdomain of example.com, any scheme
+	//	https://*.example.com    any subdomain of example.com over https
+	//	regex:https://pr-\d+\.example\.com
+	//
+	// Regular expressions must match the whole origin; they are anchored
+	// as ^(?:...)$.
+	AllowedOrigins []string
+	// AllowedOriginsFunc, if set, is called on every request instead of
+	// reading AllowedOrigins, so the list can change at runtime. Invalid
+	// entries in the returned list are ignored.
+	AllowedOriginsFunc func() []string
+	// AllowOriginFunc, if set, is consulted for origins not matched by the
+	// allowed origins list.
+	AllowOriginFunc func(origin string) bool
+	// AllowedMethods is sent in Access-Control-Allow-Methods.
+	AllowedMethods []string
+	// AllowedHeaders lists request headers a preflight may ask for; "*"
+	// allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders lists response headers browsers may read, e.g. X-Trace-Id.
+	ExposedHeaders []string
+	// AllowCredentials sets Access-Control-Allow-Credentials: true.
+	AllowCredentials bool
+	// MaxAge lets browsers cache preflight responses; zero omits the header.
+	MaxAge time.Duration
+	// RejectDisallowedOrigins answers requests from origins that are not
+	// allowed with 403. Otherwise they reach the next handler without CORS
+	// headers, and the browser enforces the policy.
+	RejectDisallowedOrigins bool
+	// Logger, if set, logs rejected origins and preflight methods.
+	Logger *zap.Logger
+}
+
+// DefaultCORSConfig returns the policy used by CORSMiddleware.
+func DefaultCORSConfig(allowedOrigins []string) CORSConfig {
+	return CORSConfig{
+		AllowedOrigins:   allowedOrigins,
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowCredentials: true,
+	}
+}
+
+// CORSMiddleware allows cross-origin requests from a fixed list of origins.
+// As before origin patterns were supported, a "*" entry allows nothing
+// rather than panicking, because the default policy sends credentials.
 func CORSMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
+	origins := slices.DeleteFunc(slices.Clone(allowedOrigins), func(o string) bool { return o == "*" })
+	return CORSWithConfig(DefaultCORSConfig(origins))
+}
+
+// CORSMiddlewareFunc is like CORSMiddleware but asks origins for the allowed
+// list on every request, so it can be backed by live configuration such as
+// utils.WatchCORSOrigins.
+func CORSMiddlewareFunc(origins func() []string) Middleware {
+	cfg := DefaultCORSConfig(nil)
+	cfg.AllowedOriginsFunc = origins
+	return CORSWithConfig(cfg)
+}
+
+// Validate checks that the policy's origin patterns compile and that "*" is
+// not combined with credentials.
+func (cfg CORSConfig) Validate() error {
+	m, err := compileOrigins(cfg.AllowedOrigins)
+	if err != nil {
+		return err
+	}
+	if m.any && cfg.AllowCredentials {
+		return ErrCORSWildcardCredentials
+	}
+	return nil
+}
+
+// CORSWithConfig applies the given CORS policy. It panics if cfg is invalid
+// (see CORSConfig.Validate).
+//
+// Only real preflights (OPTIONS with Origin and Access-Control-Request-Method)
+// are answered by the middleware; other OPTIONS requests reach the next
+// handler. Preflights for methods outside AllowedMethods get 403.
+func CORSWithConfig(cfg CORSConfig) Middleware {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	origins := newOriginPolicy(cfg)
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	anyHeader := slices.Contains(cfg.AllowedHeaders, "*")
+	maxAge := ""
+	if cfg.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
 			origin := r.Header.Get("Origin")
-			for _, allowed := range allowedOrigins {
-				if origin != allowed {
-					continue
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			allowOrigin := origins.allow(origin)
+			if allowOrigin == "" {
+				cfg.logRejected("cors: origin not allowed", r, zap.String("origin", origin))
+				if cfg.RejectDisallowedOrigins {
+					rest.WriteJSONError(w, http.StatusForbidden, "origin not allowed", tracing.GetTraceIDFromContext(r.Context()))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", allowOrigin)
+			if cfg.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				if exposeHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", exposeHeaders)
 				}
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-				w.Header().Set("Access-Control-Allow-Credentials", "true")
-				break
-			}
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusNoContent)
+				next.ServeHTTP(w, r)
 				return
 			}
-			next.ServeHTTP(w, r)
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			method := r.Header.Get("Access-Control-Request-Method")
+			if !corsMethodAllowed(method, cfg.AllowedMethods) {
+				cfg.logRejected("cors: preflight method not allowed", r, zap.String("origin", origin), zap.String("requested_method", method))
+				rest.WriteJSONError(w, http.StatusForbidden, "method not allowed", tracing.GetTraceIDFromContext(r.Context()))
+				return
+			}
+
+			if allowMethods != "" {
+				h.Set("Access-Control-Allow-Methods", allowMethods)
+			}
+			if headers := allowedRequestHeaders(r, cfg.AllowedHeaders, anyHeader); headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			} else if allowHeaders != "" && !anyHeader {
+				h.Set("Access-Control-Allow-Headers", allowHeaders)
+			}
+			if maxAge != "" {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
 		})
 	}
 }
+
+func (cfg *CORSConfig) logRejected(msg string, r *http.Request, fields ...zap.Field) {
+	if cfg.Logger == nil {
+		return
+	}
+	fields = append(fields,
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("trace_id", tracing.GetTraceIDFromContext(r.Context())),
+	)
+	cfg.Logger.Warn(msg, fields...)
+}
+
+// corsMethodAllowed reports whether a preflight may use method. CORS-safelisted
+// methods are always allowed.
+func corsMethodAllowed(method string, allowed []string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		return true
+	}
+	return slices.Contains(allowed, method)
+}
+
+// originPolicy decides which origins are allowed, caching the compiled form
+// of AllowedOriginsFunc's list until it changes.
+type originPolicy struct {
+	dynamic     func() []string
+	allowFunc   func(string) bool
+	credentials bool
+
+	mu      sync.Mutex
+	key     string
+	matcher *originMatcher
+}
+
+func newOriginPolicy(cfg CORSConfig) *originPolicy {
+	p := &originPolicy{
+		dynamic:     cfg.AllowedOriginsFunc,
+		allowFunc:   cfg.AllowOriginFunc,
+		credentials: cfg.AllowCredentials,
+	}
+	if p.dynamic == nil {
+		p.matcher, _ = compileOrigins(cfg.AllowedOrigins)
+	}
+	return p
+}
+
+func (p *originPolicy) current() *originMatcher {
+	if p.dynamic == nil {
+		return p.matcher
+	}
+
+	list := p.dynamic()
+	key := strings.Join(list, "\n")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.matcher == nil || key != p.key {
+		p.key = key
+		p.matcher = compileOriginsLenient(list)
+	}
+	return p.matcher
+}
+
+// allow returns the value for Access-Control-Allow-Origin, or "" when the
+// origin is not allowed.
+func (p *originPolicy) allow(origin string) string {
+	m := p.current()
+	if m.any && !p.credentials {
+		return "*"
+	}
+	// With credentials a "*" entry from AllowedOriginsFunc is ignored, as
+	// Validate cannot reject it up front.
+	if m.match(origin) || (p.allowFunc != nil && p.allowFunc(origin)) {
+		return origin
+	}
+	return ""
+}
+
+type originWildcard struct {
+	scheme string
+	suffix string
+}
+
+type originMatcher struct {
+	any       bool
+	exact     map[string]bool
+	wildcards []originWildcard
+	regexps   []*regexp.Regexp
+}
+
+func compileOrigins(patterns []string) (*originMatcher, error) {
+	m := &originMatcher{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		if err := m.add(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func compileOriginsLenient(patterns []string) *originMatcher {
+	m := &originMatcher{exact: make(map[string]bool)}
+	for _, pattern := range patterns {
+		_ = m.add(pattern)
+	}
+	return m
+}
+
+func (m *originMatcher) add(pattern string) error {
+	switch {
+	case pattern == "":
+	case pattern == "*":
+		m.any = true
+	case strings.HasPrefix(pattern, corsRegexPrefix):
+		re, err := regexp.Compile(`^(?:` + strings.TrimPrefix(pattern, corsRegexPrefix) + `)$`)
+		if err != nil {
+			return fmt.Errorf("cors: invalid origin pattern %q: %w", pattern, err)
+		}
+		m.regexps = append(m.regexps, re)
+	case strings.Contains(pattern, "*"):
+		scheme, host, ok := strings.Cut(pattern, "://")
+		if !ok {
+			scheme, host = "", pattern
+		}
+		suffix, ok := strings.CutPrefix(host, "*.")
+		if !ok || suffix == "" || strings.Contains(suffix, "*") {
+			return fmt.Errorf("cors: invalid origin pattern %q: only a leading \"*.\" wildcard is supported", pattern)
+		}
+		m.wildcards = append(m.wildcards, originWildcard{scheme: strings.ToLower(scheme), suffix: "." + strings.ToLower(suffix)})
+	default:
+		m.exact[pattern] = true
+	}
+	return nil
+}
+
+// match reports whether origin matches an explicit pattern; the "*" entry is
+// handled by originPolicy because it depends on credentials.
+func (m *originMatcher) match(origin string) bool {
+	if m.exact[origin] {
+		return true
+	}
+	if len(m.wildcards) > 0 {
+		scheme, host, _ := strings.Cut(strings.ToLower(origin), "://")
+		for _, w := range m.wildcards {
+			if (w.scheme == "" || w.scheme == scheme) && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+				return true
+			}
+		}
+	}
+	for _, re := range m.regexps {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedRequestHeaders echoes the headers requested by a preflight that the
+// policy allows, matching case-insensitively.
+func allowedRequestHeaders(r *http.Request, allowed []string, anyHeader bool) string {
+	requested := r.Header.Values("Access-Control-Request-Headers")
+	if len(requested) == 0 {
+		return ""
+	}
+
+	var echoed []string
+	for _, value := range requested {
+		for _, header := range strings.Split(value, ",") {
+			header = strings.TrimSpace(header)
+			if header == "" {
+				continue
+			}
+			if anyHeader || slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, header) }) {
+				echoed = append(echoed, header)
+			}
+		}
+	}
+	return strings.Join(echoed, ", ")
+}
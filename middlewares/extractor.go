@@ -0,0 +1,90 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor returns the credential carried by a request, or "" if there
+// is none.
+type TokenExtractor func(r *http.Request) string
+
+// DefaultTokenExtractor is used by AuthMiddleware and ExtractToken: a bearer
+// token, falling back to the access_token cookie.
+var DefaultTokenExtractor = ChainExtractors(BearerToken(), CookieToken("access_token"))
+
+// ChainExtractors returns the first token found by extractors, in order.
+func ChainExtractors(extractors ...TokenExtractor) TokenExtractor {
+	return func(r *http.Request) string {
+		for _, extract := range extractors {
+			if token := extract(r); token != "" {
+				return token
+			}
+		}
+		return ""
+	}
+}
+
+// BearerToken reads "Authorization: Bearer <token>"; the scheme is matched
+// case-insensitively.
+func BearerToken() TokenExtractor {
+	return authorizationScheme("Bearer")
+}
+
+// CookieToken reads the cookie with the given name.
+func CookieToken(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		if cookie, err := r.Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+}
+
+// HeaderToken reads the whole value of a custom header such as
+// X-Access-Token.
+func HeaderToken(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	}
+}
+
+// QueryToken reads a query parameter. It is meant for WebSocket upgrades,
+// where browsers cannot set headers; prefer other extractors elsewhere, as
+// URLs end up in access logs.
+func QueryToken(param string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(param)
+	}
+}
+
+// APIKeyToken reads an API key from the named header, X-API-Key if name is
+// empty, or from "Authorization: ApiKey <key>".
+func APIKeyToken(name string) TokenExtractor {
+	if name == "" {
+		name = "X-API-Key"
+	}
+	return ChainExtractors(HeaderToken(name), authorizationScheme("ApiKey"))
+}
+
+// BasicAuthToken reads HTTP Basic credentials and returns them as
+// "username:password" for the AuthServiceFunc to split.
+func BasicAuthToken() TokenExtractor {
+	return func(r *http.Request) string {
+		username, password, ok := r.BasicAuth()
+		if !ok || username == "" && password == "" {
+			return ""
+		}
+		return username + ":" + password
+	}
+}
+
+func authorizationScheme(scheme string) TokenExtractor {
+	return func(r *http.Request) string {
+		s, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(s, scheme) {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenExtractors(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor TokenExtractor
+		setup     func(r *http.Request)
+		want      string
+	}{
+		{name: "Bearer", extractor: BearerToken(), setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer abc") }, want: "abc"},
+		{name: "Bearer lower case", extractor: BearerToken(), setup: func(r *http.Request) { r.Header.Set("Authorization", "bearer abc") }, want: "abc"},
+		{name: "Bearer wrong scheme", extractor: BearerToken(), setup: func(r *http.Request) { r.Header.Set("Authorization", "Token abc") }, want: ""},
+		{name: "Bearer without token", extractor: BearerToken(), setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer") }, want: ""},
+		{name: "Cookie", extractor: CookieToken("session"), setup: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "abc"}) }, want: "abc"},
+		{name: "Cookie other name", extractor: CookieToken("session"), setup: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "access_token", Value: "abc"}) }, want: ""},
+		{name: "Header", extractor: HeaderToken("X-Access-Token"), setup: func(r *http.Request) { r.Header.Set("X-Access-Token", " abc ") }, want: "abc"},
+		{name: "Query", extractor: QueryToken("token"), setup: func(r *http.Request) { r.URL.RawQuery = "token=abc" }, want: "abc"},
+		{name: "API key header", extractor: APIKeyToken(""), setup: func(r *http.Request) { r.Header.Set("X-API-Key", "key-1") }, want: "key-1"},
+		{name: "API key scheme", extractor: APIKeyToken(""), setup: func(r *http.Request) { r.Header.Set("Authorization", "ApiKey key-1") }, want: "key-1"},
+		{name: "API key custom header", extractor: APIKeyToken("X-Service-Key"), setup: func(r *http.Request) { r.Header.Set("X-Service-Key", "key-1") }, want: "key-1"},
+		{name: "Basic", extractor: BasicAuthToken(), setup: func(r *http.Request) { r.SetBasicAuth("client", "s3cret") }, want: "client:s3cret"},
+		{name: "Basic missing", extractor: BasicAuthToken(), setup: func(r *http.Request) {}, want: ""},
+		{
+			name:      "Chain uses first match",
+			extractor: ChainExtractors(BearerToken(), QueryToken("token")),
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer header")
+				r.URL.RawQuery = "token=query"
+			},
+			want: "header",
+		},
+		{name: "Chain falls through", extractor: ChainExtractors(BearerToken(), QueryToken("token")), setup: func(r *http.Request) { r.URL.RawQuery = "token=query" }, want: "query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", http.NoBody)
+			tt.setup(req)
+			assert.Equal(t, tt.want, tt.extractor(req))
+		})
+	}
+}
+
+func TestAuthMiddlewareWithConfig_Extractor(t *testing.T) {
+	authService := func(token string) (*User, error) {
+		if token == "ws-token" {
+			return &User{ID: "123"}, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+	handler := AuthMiddlewareWithConfig(AuthConfig{
+		AuthService: authService,
+		Extractor:   QueryToken("access_token"),
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/ws?access_token=ws-token", http.NoBody)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/ws", http.NoBody)
+	req.Header.Set("Authorization", "Bearer ws-token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,120 @@
+package middlewares
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/salahfarzin/utils/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCAuthConfig configures the gRPC authentication interceptors.
+type GRPCAuthConfig struct {
+	// AuthService validates the bearer token, as for AuthMiddleware.
+	AuthService AuthServiceFunc
+	// ContextAuthService is used instead of AuthService when set.
+	ContextAuthService ContextAuthServiceFunc
+	// PublicMethods lists full method names, such as
+	// "/grpc.health.v1.Health/Check", that skip authentication.
+	PublicMethods []string
+	// MethodRoles requires one of the listed roles for a full method name.
+	MethodRoles map[string][]string
+	// Revocations, if set, is consulted after the token was validated, as
+	// for AuthConfig.
+	Revocations RevocationStore
+}
+
+// AuthUnaryInterceptor is the gRPC counterpart of AuthMiddleware for unary
+// calls: it validates the bearer token from the "authorization" metadata and
+// stores the user under UserKey.
+func AuthUnaryInterceptor(cfg GRPCAuthConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := cfg.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor is AuthUnaryInterceptor for streaming calls.
+func AuthStreamInterceptor(cfg GRPCAuthConfig) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := cfg.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (cfg GRPCAuthConfig) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if slices.Contains(cfg.PublicMethods, method) {
+		return ctx, nil
+	}
+
+	token := ExtractTokenFromMetadata(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing access token")
+	}
+	authService := cfg.ContextAuthService
+	if authService == nil {
+		authService = cfg.AuthService.withContext()
+	}
+	user, err := authService(ctx, token)
+	if err == nil && user == nil {
+		err = errNoUser
+	}
+	if err == nil {
+		err = checkUser(ctx, cfg.Revocations, token, user)
+	}
+	if err != nil {
+		code, msg := classifyAuthError(err)
+		if code == AuthErrUnavailable {
+			return nil, status.Error(codes.Unavailable, msg)
+		}
+		return nil, status.Error(codes.Unauthenticated, msg)
+	}
+
+	if roles, ok := cfg.MethodRoles[method]; ok {
+		if !slices.ContainsFunc(roles, func(role string) bool { return slices.Contains(user.Roles, role) }) {
+			return nil, status.Error(codes.PermissionDenied, "permission denied")
+		}
+	}
+	if user.TenantID != "" {
+		if tenantID := tracing.GetTenantIDFromContext(ctx); tenantID != "" && tenantID != user.TenantID {
+			return nil, status.Error(codes.PermissionDenied, "tenant mismatch")
+		}
+		ctx = tracing.InjectTenantIDToContext(ctx, user.TenantID)
+	}
+	return context.WithValue(ctx, UserKey, user), nil
+}
+
+// ExtractTokenFromMetadata returns the bearer token from the incoming
+// "authorization" metadata, or "".
+func ExtractTokenFromMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, v := range md.Get("authorization") {
+		if scheme, token, found := strings.Cut(v, " "); found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
+
+// authServerStream overrides the context of a grpc.ServerStream.
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
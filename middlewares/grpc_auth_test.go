@@ -0,0 +1,137 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// userHealthServer records the user each call was authenticated as.
+type userHealthServer struct {
+	*health.Server
+	users chan User
+}
+
+func (s *userHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	s.users <- GetUserFromContext(ctx)
+	return s.Server.Check(ctx, req)
+}
+
+func (s *userHealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	s.users <- GetUserFromContext(stream.Context())
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+func newGRPCAuthTestClient(t *testing.T, cfg GRPCAuthConfig) (healthpb.HealthClient, chan User) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(AuthUnaryInterceptor(cfg)),
+		grpc.StreamInterceptor(AuthStreamInterceptor(cfg)),
+	)
+	hs := &userHealthServer{Server: health.NewServer(), users: make(chan User, 1)}
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return healthpb.NewHealthClient(conn), hs.users
+}
+
+func TestGRPCAuthInterceptors(t *testing.T) {
+	authService := func(token string) (*User, error) {
+		switch token {
+		case "admin-token":
+			return &User{ID: "1", Uuid: "uuid-1", Roles: []string{"admin"}}, nil
+		case "user-token":
+			return &User{ID: "2", Uuid: "uuid-2", Roles: []string{"user"}}, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+	client, users := newGRPCAuthTestClient(t, GRPCAuthConfig{
+		AuthService: authService,
+		MethodRoles: map[string][]string{healthpb.Health_Watch_FullMethodName: {"admin"}},
+	})
+
+	withToken := func(token string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	}
+
+	t.Run("Unary valid token", func(t *testing.T) {
+		_, err := client.Check(withToken("user-token"), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		user := <-users
+		assert.Equal(t, "2", user.ID)
+		assert.Equal(t, []string{"user"}, user.Roles)
+	})
+
+	t.Run("Forged metadata is ignored", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(withToken("user-token"), "x-user-id", "1", "x-user-roles", "admin")
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "2", (<-users).ID)
+	})
+
+	t.Run("Unary missing token", func(t *testing.T) {
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("Unary invalid token", func(t *testing.T) {
+		_, err := client.Check(withToken("bogus"), &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("Stream allowed role", func(t *testing.T) {
+		stream, err := client.Watch(withToken("admin-token"), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, "1", (<-users).ID)
+	})
+
+	t.Run("Stream missing role", func(t *testing.T) {
+		stream, err := client.Watch(withToken("user-token"), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+}
+
+func TestGRPCAuthInterceptors_PublicMethods(t *testing.T) {
+	client, users := newGRPCAuthTestClient(t, GRPCAuthConfig{
+		AuthService:   func(string) (*User, error) { return nil, errors.New("unreachable") },
+		PublicMethods: []string{healthpb.Health_Check_FullMethodName},
+	})
+
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, User{}, <-users)
+}
+
+func TestExtractTokenFromMetadata(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "bearer abc"))
+	assert.Equal(t, "abc", ExtractTokenFromMetadata(ctx))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic abc"))
+	assert.Empty(t, ExtractTokenFromMetadata(ctx))
+
+	assert.Empty(t, ExtractTokenFromMetadata(context.Background()))
+}
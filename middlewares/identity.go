@@ -0,0 +1,199 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserAssertionHeader carries the signed identity assertion emitted by
+// AuthMiddleware. gRPC-Gateway must forward it as metadata together with the
+// other x-user-* headers.
+const UserAssertionHeader = "x-user-assertion"
+
+// UserInfoHeader carries the whole User, as encoded by EncodeUser.
+const UserInfoHeader = "x-user-info"
+
+// maxUserInfoSize bounds encoded users so they fit comfortably in a header.
+const maxUserInfoSize = 4 << 10
+
+// userAssertionTTL bounds how long an assertion is accepted after it was
+// issued; assertionLeeway tolerates clock skew between services.
+const (
+	userAssertionTTL = 5 * time.Minute
+	assertionLeeway  = 30 * time.Second
+)
+
+var (
+	ErrAssertionMissing = errors.New("missing user assertion")
+	ErrAssertionInvalid = errors.New("invalid user assertion")
+	ErrAssertionExpired = errors.New("user assertion expired")
+	ErrUserInfoTooLarge = errors.New("encoded user exceeds size limit")
+)
+
+var (
+	identityMu    sync.RWMutex
+	identityKey   []byte
+	trustUnsigned bool
+)
+
+// SetIdentityKey sets the HMAC key shared by the gateway and the services
+// behind it. Once set, AuthMiddleware signs the identity it forwards and
+// GetUserFromContext trusts metadata only with a valid signature. Without a
+// key, GetUserFromContext ignores metadata unless SetTrustUnsignedIdentity
+// opts out.
+func SetIdentityKey(key []byte) {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	identityKey = append([]byte(nil), key...)
+	if len(key) == 0 {
+		identityKey = nil
+	}
+}
+
+func currentIdentityKey() []byte {
+	identityMu.RLock()
+	defer identityMu.RUnlock()
+	return identityKey
+}
+
+// SetTrustUnsignedIdentity makes GetUserFromContext accept the plain
+// x-user-id, x-user-uuid, x-user-email and x-user-roles metadata when no
+// identity key is set.
+//
+// This is INSECURE: any client that reaches the service directly can claim
+// to be any user with any roles. Use it only while migrating to
+// SetIdentityKey, behind a network boundary that strips x-user-* headers.
+// The x-user-info header is never trusted unsigned.
+func SetTrustUnsignedIdentity(trust bool) {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	trustUnsigned = trust
+}
+
+func trustUnsignedIdentity() bool {
+	identityMu.RLock()
+	defer identityMu.RUnlock()
+	return trustUnsigned
+}
+
+// EncodeUser encodes user as base64url JSON for UserInfoHeader.
+func EncodeUser(user *User) (string, error) {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	if len(encoded) > maxUserInfoSize {
+		return "", ErrUserInfoTooLarge
+	}
+	return encoded, nil
+}
+
+// DecodeUser decodes a user encoded by EncodeUser.
+func DecodeUser(encoded string) (*User, error) {
+	if len(encoded) > maxUserInfoSize {
+		return nil, ErrUserInfoTooLarge
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var user User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+type userAssertion struct {
+	User     *User `json:"user"`
+	IssuedAt int64 `json:"iat"`
+	Expires  int64 `json:"exp"`
+}
+
+// SignUserAssertion returns an assertion of the whole user, signed with key,
+// that is valid for ttl.
+func SignUserAssertion(key []byte, user *User, now time.Time, ttl time.Duration) (string, error) {
+	payload, err := json.Marshal(userAssertion{User: user, IssuedAt: now.Unix(), Expires: now.Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	if len(encoded) > maxUserInfoSize {
+		return "", ErrUserInfoTooLarge
+	}
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(assertionMAC(key, encoded)), nil
+}
+
+// VerifyUserAssertion checks the signature and lifetime of an assertion made
+// by SignUserAssertion and returns the asserted user.
+func VerifyUserAssertion(key []byte, assertion string, now time.Time) (*User, error) {
+	if assertion == "" {
+		return nil, ErrAssertionMissing
+	}
+	if len(assertion) > 2*maxUserInfoSize {
+		return nil, ErrUserInfoTooLarge
+	}
+	encoded, sig, ok := strings.Cut(assertion, ".")
+	if !ok {
+		return nil, ErrAssertionInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, assertionMAC(key, encoded)) {
+		return nil, ErrAssertionInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrAssertionInvalid
+	}
+	var a userAssertion
+	if err := json.Unmarshal(payload, &a); err != nil || a.User == nil {
+		return nil, ErrAssertionInvalid
+	}
+	if now.After(time.Unix(a.Expires, 0).Add(assertionLeeway)) || now.Before(time.Unix(a.IssuedAt, 0).Add(-assertionLeeway)) {
+		return nil, ErrAssertionExpired
+	}
+	return a.User, nil
+}
+
+func assertionMAC(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// setIdentityHeaders replaces any client-supplied x-user-* headers with the
+// identity of user, so gRPC-Gateway forwards only what the gateway vouches for.
+func setIdentityHeaders(r *http.Request, user *User) {
+	stripIdentityHeaders(r)
+
+	r.Header.Set("x-user-id", user.ID)
+	r.Header.Set("x-user-uuid", user.Uuid)
+	r.Header.Set("x-user-email", user.Email)
+	r.Header.Set("x-user-roles", strings.Join(user.Roles, ","))
+	if info, err := EncodeUser(user); err == nil {
+		r.Header.Set(UserInfoHeader, info)
+	}
+
+	if key := currentIdentityKey(); key != nil {
+		if assertion, err := SignUserAssertion(key, user, time.Now(), userAssertionTTL); err == nil {
+			r.Header.Set(UserAssertionHeader, assertion)
+		}
+	}
+}
+
+// stripIdentityHeaders removes client-supplied x-user-* headers.
+func stripIdentityHeaders(r *http.Request) {
+	for name := range r.Header {
+		if strings.HasPrefix(name, "X-User-") {
+			r.Header.Del(name)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func useIdentityKey(t *testing.T, key []byte) {
+	t.Helper()
+	SetIdentityKey(key)
+	t.Cleanup(func() { SetIdentityKey(nil) })
+}
+
+func useUnsignedIdentity(t *testing.T) {
+	t.Helper()
+	SetTrustUnsignedIdentity(true)
+	t.Cleanup(func() { SetTrustUnsignedIdentity(false) })
+}
+
+func TestUserAssertion(t *testing.T) {
+	key := []byte("shared-key")
+	now := time.Now()
+	user := &User{ID: "123", Uuid: "uuid-123", Email: "test@example.com", Roles: []string{"admin", "user"}}
+
+	assertion, err := SignUserAssertion(key, user, now, time.Minute)
+	require.NoError(t, err)
+
+	got, err := VerifyUserAssertion(key, assertion, now)
+	require.NoError(t, err)
+	assert.Equal(t, user, got)
+
+	payload, sig, _ := strings.Cut(assertion, ".")
+	forged, err := SignUserAssertion([]byte("guess"), &User{ID: "123", Roles: []string{"root"}}, now, time.Minute)
+	require.NoError(t, err)
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name      string
+		key       []byte
+		assertion string
+		now       time.Time
+		want      error
+	}{
+		{name: "Missing", key: key, assertion: "", now: now, want: ErrAssertionMissing},
+		{name: "Malformed", key: key, assertion: "garbage", now: now, want: ErrAssertionInvalid},
+		{name: "Wrong key", key: []byte("other"), assertion: assertion, now: now, want: ErrAssertionInvalid},
+		{name: "Swapped payload", key: key, assertion: forgedPayload + "." + sig, now: now, want: ErrAssertionInvalid},
+		{name: "Truncated signature", key: key, assertion: payload + "." + sig[:10], now: now, want: ErrAssertionInvalid},
+		{name: "Expired", key: key, assertion: assertion, now: now.Add(2 * time.Minute), want: ErrAssertionExpired},
+		{name: "Issued in the future", key: key, assertion: assertion, now: now.Add(-2 * time.Minute), want: ErrAssertionExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyUserAssertion(tt.key, tt.assertion, tt.now)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestAuthMiddleware_StripsForgedIdentityHeaders(t *testing.T) {
+	useIdentityKey(t, []byte("shared-key"))
+
+	authService := func(token string) (*User, error) {
+		return &User{ID: "123", Uuid: "uuid-123", Roles: []string{"user"}}, nil
+	}
+	handler := AuthMiddleware(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	req.Header.Set("X-User-Id", "999")
+	req.Header.Set("X-User-Roles", "admin")
+	req.Header.Set("X-User-Email", "attacker@example.com")
+	req.Header.Set("X-User-Assertion", "forged")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "123", req.Header.Get("x-user-id"))
+	assert.Equal(t, "user", req.Header.Get("x-user-roles"))
+	assert.Empty(t, req.Header.Get("x-user-email"))
+
+	user, err := VerifyUserAssertion([]byte("shared-key"), req.Header.Get(UserAssertionHeader), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "123", user.ID)
+}
+
+func TestGetUserFromContext_SignedMetadata(t *testing.T) {
+	key := []byte("shared-key")
+	useIdentityKey(t, key)
+
+	assertion, err := SignUserAssertion(key, &User{ID: "grpc-123", Uuid: "grpc-uuid-123", Roles: []string{"user"}}, time.Now(), time.Minute)
+	require.NoError(t, err)
+
+	t.Run("Valid assertion", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			"x-user-id", "grpc-123",
+			"x-user-roles", "admin",
+			UserAssertionHeader, assertion,
+		))
+		result := GetUserFromContext(ctx)
+		assert.Equal(t, "grpc-123", result.ID)
+		assert.Equal(t, []string{"user"}, result.Roles, "roles must come from the signed assertion")
+	})
+
+	t.Run("Unsigned metadata", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user-id", "grpc-123", "x-user-roles", "admin"))
+		assert.Equal(t, User{}, GetUserFromContext(ctx))
+	})
+
+	t.Run("Forged assertion", func(t *testing.T) {
+		forged, err := SignUserAssertion([]byte("guess"), &User{ID: "grpc-123", Roles: []string{"admin"}}, time.Now(), time.Minute)
+		require.NoError(t, err)
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(UserAssertionHeader, forged))
+		assert.Equal(t, User{}, GetUserFromContext(ctx))
+	})
+}
+
+func fullTestUser() *User {
+	active := true
+	mobile := "+15550100"
+	first, last := "Ada", "Lovelace"
+	return &User{
+		ID:        "123",
+		Uuid:      "uuid-123",
+		Email:     "test@example.com",
+		Roles:     []string{"admin", "user"},
+		IsActive:  &active,
+		Mobile:    &mobile,
+		FirstName: &first,
+		LastName:  &last,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestEncodeDecodeUser(t *testing.T) {
+	user := fullTestUser()
+
+	encoded, err := EncodeUser(user)
+	require.NoError(t, err)
+	decoded, err := DecodeUser(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, user, decoded)
+
+	_, err = EncodeUser(&User{ID: "1", Roles: []string{strings.Repeat("r", maxUserInfoSize)}})
+	assert.ErrorIs(t, err, ErrUserInfoTooLarge)
+	_, err = DecodeUser(strings.Repeat("A", maxUserInfoSize+1))
+	assert.ErrorIs(t, err, ErrUserInfoTooLarge)
+	_, err = DecodeUser("!!!")
+	assert.Error(t, err)
+}
+
+// gatewayMetadata runs AuthMiddleware for user and returns the forwarded
+// x-user-* headers as gRPC-Gateway would pass them on.
+func gatewayMetadata(t *testing.T, user *User) metadata.MD {
+	t.Helper()
+	handler := AuthMiddleware(func(string) (*User, error) { return user, nil })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	md := metadata.MD{}
+	for name, vals := range req.Header {
+		if strings.HasPrefix(name, "X-User-") {
+			md.Append(name, vals...)
+		}
+	}
+	return md
+}
+
+func TestGetUserFromContext_FullUser(t *testing.T) {
+	user := fullTestUser()
+
+	t.Run("Unsigned", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), gatewayMetadata(t, user))
+		assert.Equal(t, User{}, GetUserFromContext(ctx), "unsigned metadata is ignored by default")
+	})
+
+	t.Run("Trusted unsigned", func(t *testing.T) {
+		useUnsignedIdentity(t)
+		ctx := metadata.NewIncomingContext(context.Background(), gatewayMetadata(t, user))
+		want := User{ID: user.ID, Uuid: user.Uuid, Email: user.Email, Roles: user.Roles}
+		assert.Equal(t, want, GetUserFromContext(ctx), "profile fields only travel signed")
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		useIdentityKey(t, []byte("shared-key"))
+		ctx := metadata.NewIncomingContext(context.Background(), gatewayMetadata(t, user))
+		assert.Equal(t, *user, GetUserFromContext(ctx))
+	})
+}
+
+func TestGetUserFromContext_UnsignedUserInfo(t *testing.T) {
+	useUnsignedIdentity(t)
+
+	forged, err := EncodeUser(&User{ID: "999", Roles: []string{"admin"}, IsService: true, TenantID: "globex"})
+	require.NoError(t, err)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-user-id", "123",
+		"x-user-roles", "user",
+		UserInfoHeader, forged,
+	))
+
+	assert.Equal(t, User{ID: "123", Roles: []string{"user"}}, GetUserFromContext(ctx))
+}
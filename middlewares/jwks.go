@@ -0,0 +1,261 @@
+package middlewares
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWKS is a KeySet that fetches keys from a JSON Web Key Set endpoint and
+// caches them. Keys are refreshed every RefreshInterval, and immediately
+// when a token names an unknown key ID, so key rotation is picked up without
+// a restart. Fetches happen at most once per MinRefreshInterval, including
+// retries after a failure, and concurrent callers share a single fetch.
+type JWKS struct {
+	URL                string
+	Client             *http.Client
+	RefreshInterval    time.Duration
+	MinRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	lastErr     error
+	inflight    *jwksFetch
+}
+
+// jwksFetch is a fetch in progress; done is closed when err is set.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewJWKS creates a JWKS for url with a one hour refresh interval.
+func NewJWKS(url string) *JWKS {
+	return &JWKS{
+		URL:                url,
+		Client:             &http.Client{Timeout: 10 * time.Second},
+		RefreshInterval:    time.Hour,
+		MinRefreshInterval: time.Minute,
+	}
+}
+
+// Key returns the key with the given ID. An empty kid matches the only key of
+// a single-key set.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	stale := j.keys == nil || time.Since(j.fetchedAt) > j.RefreshInterval
+	j.mu.Unlock()
+
+	if stale {
+		// Keep serving the old keys if the refresh fails.
+		if err := j.refresh(ctx); err != nil && !j.loaded() {
+			return nil, err
+		}
+	}
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+
+	if err := j.refresh(ctx); err != nil && !errors.Is(err, errJWKSBackoff) {
+		return nil, err
+	}
+	if key, ok := j.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (j *JWKS) loaded() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.keys != nil
+}
+
+func (j *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// errJWKSBackoff means the last fetch was too recent to try again.
+var errJWKSBackoff = errors.New("JWKS refresh rate limited")
+
+// defaultJWKSFetchTimeout bounds a fetch when Client has no Timeout.
+const defaultJWKSFetchTimeout = 10 * time.Second
+
+// refresh fetches the key set unless the last attempt was less than
+// MinRefreshInterval ago. The fetch runs in the background, detached from
+// the caller's ctx, so one cancelled request cannot fail it for everyone
+// else; every caller, including the first, waits for the result or gives up
+// when its own ctx is done.
+func (j *JWKS) refresh(ctx context.Context) error {
+	j.mu.Lock()
+	f := j.inflight
+	if f == nil {
+		if !j.attemptedAt.IsZero() && time.Since(j.attemptedAt) < j.MinRefreshInterval {
+			err := j.lastErr
+			j.mu.Unlock()
+			if err != nil {
+				return fmt.Errorf("%w: %w", errJWKSBackoff, err)
+			}
+			return errJWKSBackoff
+		}
+		f = &jwksFetch{done: make(chan struct{})}
+		j.inflight = f
+		j.attemptedAt = time.Now()
+		go j.runFetch(context.WithoutCancel(ctx), f, j.attemptedAt)
+	}
+	j.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runFetch performs the fetch f and records its result.
+func (j *JWKS) runFetch(ctx context.Context, f *jwksFetch, attemptedAt time.Time) {
+	if j.Client == nil || j.Client.Timeout <= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultJWKSFetchTimeout)
+		defer cancel()
+	}
+	keys, err := j.fetch(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case err == nil:
+		j.keys = keys
+		j.fetchedAt = attemptedAt
+	case errors.Is(err, context.Canceled):
+		// Not the endpoint's fault; let the next caller try again.
+		j.attemptedAt = time.Time{}
+	}
+	j.lastErr = err
+	j.inflight = nil
+	f.err = err
+	close(f.done)
+}
+
+// fetch downloads and parses the key set.
+func (j *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	client := j.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip keys we cannot use rather than failing the whole set.
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 coordinates")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		return ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,327 @@
+package middlewares
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Token validation errors. Verify wraps them, so callers can use errors.Is.
+var (
+	ErrTokenMalformed        = errors.New("token is malformed")
+	ErrTokenSignatureInvalid = errors.New("token signature is invalid")
+	ErrTokenExpired          = errors.New("token is expired")
+	ErrTokenNotYetValid      = errors.New("token is not valid yet")
+	ErrTokenInvalidIssuer    = errors.New("token has an invalid issuer")
+	ErrTokenInvalidAudience  = errors.New("token has an invalid audience")
+	// ErrTokenRevoked is for AuthServiceFuncs that track revoked tokens.
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// Supported JWT signing algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// KeySet provides public keys for verifying JWT signatures. Keys are
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// StaticKeySet is a KeySet with fixed keys, indexed by key ID.
+type StaticKeySet map[string]crypto.PublicKey
+
+func (s StaticKeySet) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// JWTConfig configures local JWT verification.
+type JWTConfig struct {
+	// Keys verifies RS256, ES256 and EdDSA tokens, e.g. a *JWKS.
+	Keys KeySet
+	// HMACSecret verifies HS256 tokens.
+	HMACSecret []byte
+	// Algorithms restricts the accepted algorithms. By default the
+	// asymmetric algorithms are accepted when Keys is set and HS256 when
+	// HMACSecret is set.
+	Algorithms []string
+	// Issuer, if set, must match the iss claim.
+	Issuer string
+	// Audience, if set, must be one of the aud claim's values.
+	Audience string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+	// RequireExpiry rejects tokens without an exp claim as malformed.
+	RequireExpiry bool
+	// ClaimsToUser maps verified claims to a User. Defaults to ClaimsToUser.
+	ClaimsToUser func(claims map[string]any) (*User, error)
+	// Now returns the current time; defaults to time.Now.
+	Now func() time.Time
+}
+
+// JWTVerifier verifies JWTs locally, without calling an auth service.
+type JWTVerifier struct {
+	cfg JWTConfig
+}
+
+// NewJWTVerifier creates a verifier from cfg.
+func NewJWTVerifier(cfg JWTConfig) *JWTVerifier {
+	if len(cfg.Algorithms) == 0 {
+		if cfg.Keys != nil {
+			cfg.Algorithms = append(cfg.Algorithms, AlgRS256, AlgES256, AlgEdDSA)
+		}
+		if len(cfg.HMACSecret) > 0 {
+			cfg.Algorithms = append(cfg.Algorithms, AlgHS256)
+		}
+	}
+	if cfg.ClaimsToUser == nil {
+		cfg.ClaimsToUser = ClaimsToUser
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &JWTVerifier{cfg: cfg}
+}
+
+// JWTAuthMiddleware is AuthMiddleware backed by a local JWTVerifier.
+func JWTAuthMiddleware(cfg JWTConfig) Middleware {
+	return AuthMiddleware(NewJWTVerifier(cfg).AuthService())
+}
+
+// AuthService adapts the verifier to an AuthServiceFunc.
+func (v *JWTVerifier) AuthService() AuthServiceFunc {
+	return func(token string) (*User, error) {
+		return v.Verify(context.Background(), token)
+	}
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the token's signature and registered claims and maps its
+// claims to a User.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*User, error) {
+	claims, err := v.VerifyClaims(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return v.cfg.ClaimsToUser(claims)
+}
+
+// VerifyClaims is like Verify but returns the raw claims.
+func (v *JWTVerifier) VerifyClaims(ctx context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(v.cfg.Algorithms, header.Alg) {
+		return nil, fmt.Errorf("%w: algorithm %q is not allowed", ErrTokenSignatureInvalid, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+	if err := v.verifySignature(ctx, header, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *JWTVerifier) verifySignature(ctx context.Context, header jwtHeader, signed string, sig []byte) error {
+	if header.Alg == AlgHS256 {
+		mac := hmac.New(sha256.New, v.cfg.HMACSecret)
+		mac.Write([]byte(signed))
+		if len(v.cfg.HMACSecret) == 0 || !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrTokenSignatureInvalid
+		}
+		return nil
+	}
+
+	if v.cfg.Keys == nil {
+		return fmt.Errorf("%w: no key set configured", ErrTokenSignatureInvalid)
+	}
+	key, err := v.cfg.Keys.Key(ctx, header.Kid)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenSignatureInvalid, err)
+	}
+
+	digest := sha256.Sum256([]byte(signed))
+	ok := false
+	switch header.Alg {
+	case AlgRS256:
+		if pub, isRSA := key.(*rsa.PublicKey); isRSA {
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+		}
+	case AlgES256:
+		if pub, isEC := key.(*ecdsa.PublicKey); isEC && len(sig) == 64 {
+			r := new(big.Int).SetBytes(sig[:32])
+			s := new(big.Int).SetBytes(sig[32:])
+			ok = ecdsa.Verify(pub, digest[:], r, s)
+		}
+	case AlgEdDSA:
+		if pub, isEd := key.(ed25519.PublicKey); isEd {
+			ok = ed25519.Verify(pub, []byte(signed), sig)
+		}
+	}
+	if !ok {
+		return ErrTokenSignatureInvalid
+	}
+	return nil
+}
+
+func (v *JWTVerifier) validateClaims(claims map[string]any) error {
+	now := v.cfg.Now()
+
+	exp, hasExp, err := numericClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !hasExp && v.cfg.RequireExpiry {
+		return fmt.Errorf("%w: missing exp", ErrTokenMalformed)
+	}
+	if hasExp && !now.Before(exp.Add(v.cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+	nbf, hasNbf, err := numericClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if hasNbf && now.Add(v.cfg.Leeway).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+	if _, _, err := numericClaim(claims, "iat"); err != nil {
+		return err
+	}
+	if v.cfg.Issuer != "" && stringClaim(claims, "iss") != v.cfg.Issuer {
+		return ErrTokenInvalidIssuer
+	}
+	if v.cfg.Audience != "" && !slices.Contains(stringsClaim(claims, "aud"), v.cfg.Audience) {
+		return ErrTokenInvalidAudience
+	}
+	return nil
+}
+
+// ClaimsToUser is the default claim mapping: sub (ID), uuid, email, roles,
+// given_name/first_name, family_name/last_name, phone_number/mobile, gender,
+// birthdate, picture/avatar, tenant_id, is_active, iat (IssuedAt) and exp
+// (ExpiresAt).
+func ClaimsToUser(claims map[string]any) (*User, error) {
+	user := &User{
+		ID:       stringClaim(claims, "sub"),
+		Uuid:     stringClaim(claims, "uuid"),
+		Email:    stringClaim(claims, "email"),
+		Roles:    stringsClaim(claims, "roles"),
+		TenantID: stringClaim(claims, "tenant_id"),
+	}
+	if user.ID == "" && user.Uuid == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrTokenMalformed)
+	}
+
+	user.FirstName = optionalClaim(claims, "given_name", "first_name")
+	user.LastName = optionalClaim(claims, "family_name", "last_name")
+	user.Mobile = optionalClaim(claims, "phone_number", "mobile")
+	user.Gender = optionalClaim(claims, "gender")
+	user.Birthdate = optionalClaim(claims, "birthdate")
+	user.Avatar = optionalClaim(claims, "picture", "avatar")
+	if active, ok := claims["is_active"].(bool); ok {
+		user.IsActive = &active
+	}
+	if iat, ok, _ := numericClaim(claims, "iat"); ok {
+		user.IssuedAt = iat
+	}
+	if exp, ok, _ := numericClaim(claims, "exp"); ok {
+		user.ExpiresAt = exp
+	}
+	return user, nil
+}
+
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+	return nil
+}
+
+// numericClaim reads a NumericDate claim. It reports whether the claim is
+// present, and fails with ErrTokenMalformed if it is not a number.
+func numericClaim(claims map[string]any, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok || value == nil {
+		return time.Time{}, false, nil
+	}
+	n, ok := value.(float64)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrTokenMalformed, name)
+	}
+	return time.Unix(int64(n), 0), true, nil
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+// stringsClaim reads a claim that may be a single string or a list.
+func stringsClaim(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func optionalClaim(claims map[string]any, names ...string) *string {
+	for _, name := range names {
+		if s := stringClaim(claims, name); s != "" {
+			return &s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,401 @@
+package middlewares
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signJWT builds a compact JWT signed with key, which is an *rsa.PrivateKey,
+// *ecdsa.PrivateKey, ed25519.PrivateKey or an HMAC secret ([]byte).
+func signJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	default:
+		t.Fatalf("unsupported key %T", key)
+	}
+	return signed + "." + b64(sig)
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+type testJWKSServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	keys     []map[string]string
+	requests atomic.Int32
+}
+
+func newTestJWKSServer(t *testing.T, keys ...map[string]string) *testJWKSServer {
+	s := &testJWKSServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testJWKSServer) setKeys(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":        "123",
+		"uuid":       "uuid-123",
+		"email":      "test@example.com",
+		"roles":      []string{"admin", "user"},
+		"given_name": "Ada",
+		"is_active":  true,
+		"iss":        "https://auth.example.com",
+		"aud":        []string{"orders", "billing"},
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"nbf":        time.Now().Add(-time.Minute).Unix(),
+	}
+}
+
+func TestJWTVerifier_Algorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("hmac-secret")
+
+	verifier := NewJWTVerifier(JWTConfig{
+		Keys:       StaticKeySet{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey, "ed": edPub},
+		HMACSecret: secret,
+		Issuer:     "https://auth.example.com",
+		Audience:   "orders",
+	})
+
+	tests := []struct {
+		alg string
+		kid string
+		key any
+	}{
+		{alg: AlgRS256, kid: "rsa", key: rsaKey},
+		{alg: AlgES256, kid: "ec", key: ecKey},
+		{alg: AlgEdDSA, kid: "ed", key: edKey},
+		{alg: AlgHS256, key: secret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			user, err := verifier.Verify(context.Background(), signJWT(t, tt.alg, tt.kid, tt.key, validClaims()))
+			require.NoError(t, err)
+			assert.Equal(t, "123", user.ID)
+			assert.Equal(t, "uuid-123", user.Uuid)
+			assert.Equal(t, "test@example.com", user.Email)
+			assert.Equal(t, []string{"admin", "user"}, user.Roles)
+			require.NotNil(t, user.FirstName)
+			assert.Equal(t, "Ada", *user.FirstName)
+			require.NotNil(t, user.IsActive)
+			assert.True(t, *user.IsActive)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), user.ExpiresAt, 2*time.Second)
+		})
+	}
+}
+
+func TestJWTVerifier_Rejects(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	now := time.Now()
+	verifier := NewJWTVerifier(JWTConfig{
+		Keys:     StaticKeySet{"rsa": &rsaKey.PublicKey},
+		Issuer:   "https://auth.example.com",
+		Audience: "orders",
+		Leeway:   30 * time.Second,
+		Now:      func() time.Time { return now },
+	})
+
+	with := func(name string, value any) map[string]any {
+		claims := validClaims()
+		claims[name] = value
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{name: "Garbage", token: "not-a-jwt", want: ErrTokenMalformed},
+		{name: "Bad base64", token: "###.###.###", want: ErrTokenMalformed},
+		{name: "Wrong key", token: signJWT(t, AlgRS256, "rsa", otherKey, validClaims()), want: ErrTokenSignatureInvalid},
+		{name: "Unknown kid", token: signJWT(t, AlgRS256, "other", rsaKey, validClaims()), want: ErrTokenSignatureInvalid},
+		{name: "HS256 not enabled", token: signJWT(t, AlgHS256, "rsa", []byte("guess"), validClaims()), want: ErrTokenSignatureInvalid},
+		{name: "Expired", token: signJWT(t, AlgRS256, "rsa", rsaKey, with("exp", now.Add(-time.Minute).Unix())), want: ErrTokenExpired},
+		{name: "Not yet valid", token: signJWT(t, AlgRS256, "rsa", rsaKey, with("nbf", now.Add(time.Minute).Unix())), want: ErrTokenNotYetValid},
+		{name: "Wrong issuer", token: signJWT(t, AlgRS256, "rsa", rsaKey, with("iss", "https://evil.com")), want: ErrTokenInvalidIssuer},
+		{name: "Wrong audience", token: signJWT(t, AlgRS256, "rsa", rsaKey, with("aud", "billing")), want: ErrTokenInvalidAudience},
+		{name: "Missing subject", token: signJWT(t, AlgRS256, "rsa", rsaKey, map[string]any{"iss": "https://auth.example.com", "aud": "orders"}), want: ErrTokenMalformed},
+		{name: "String exp", token: signJWT(t, AlgRS256, "rsa", rsaKey, with("exp", "0")), want: ErrTokenMalformed},
+		{name: "String nbf", token: signJWT(t, AlgRS256, "rsa", rsaKey, with("nbf", "9999999999")), want: ErrTokenMalformed},
+		{name: "String iat", token: signJWT(t, AlgRS256, "rsa", rsaKey, with("iat", "now")), want: ErrTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tt.token)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	t.Run("Within leeway", func(t *testing.T) {
+		_, err := verifier.Verify(context.Background(), signJWT(t, AlgRS256, "rsa", rsaKey, with("exp", now.Add(-10*time.Second).Unix())))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Missing exp", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "exp")
+		token := signJWT(t, AlgRS256, "rsa", rsaKey, claims)
+
+		_, err := verifier.Verify(context.Background(), token)
+		assert.NoError(t, err, "exp is optional by default")
+
+		strict := NewJWTVerifier(JWTConfig{Keys: StaticKeySet{"rsa": &rsaKey.PublicKey}, RequireExpiry: true})
+		_, err = strict.Verify(context.Background(), token)
+		assert.ErrorIs(t, err, ErrTokenMalformed)
+		_, err = strict.Verify(context.Background(), signJWT(t, AlgRS256, "rsa", rsaKey, validClaims()))
+		assert.NoError(t, err)
+	})
+}
+
+func TestJWKS_Rotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := newTestJWKSServer(t, rsaJWK("old", &oldKey.PublicKey))
+	jwks := NewJWKS(server.URL)
+	jwks.MinRefreshInterval = 0
+
+	verifier := NewJWTVerifier(JWTConfig{Keys: jwks})
+
+	_, err = verifier.Verify(context.Background(), signJWT(t, AlgRS256, "old", oldKey, validClaims()))
+	require.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), signJWT(t, AlgRS256, "old", oldKey, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), server.requests.Load(), "keys should be cached")
+
+	server.setKeys(rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey))
+	_, err = verifier.Verify(context.Background(), signJWT(t, AlgRS256, "new", newKey, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), server.requests.Load(), "unknown kid should trigger a refresh")
+
+	jwks.MinRefreshInterval = time.Hour
+	_, err = verifier.Verify(context.Background(), signJWT(t, AlgRS256, "missing", newKey, validClaims()))
+	assert.ErrorIs(t, err, ErrTokenSignatureInvalid)
+	assert.Equal(t, int32(2), server.requests.Load(), "refreshes should be rate limited")
+}
+
+func TestJWKS_FailedRefreshBacksOff(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{rsaJWK("k", &key.PublicKey)}})
+	}))
+	t.Cleanup(server.Close)
+
+	jwks := NewJWKS(server.URL)
+	jwks.RefreshInterval = 0
+	jwks.MinRefreshInterval = 0
+	_, err = jwks.Key(context.Background(), "k")
+	require.NoError(t, err)
+
+	// Every call is due a periodic refresh, but a failing endpoint is not
+	// hammered and the cached keys keep working.
+	failing.Store(true)
+	jwks.MinRefreshInterval = time.Hour
+	jwks.mu.Lock()
+	jwks.attemptedAt = time.Time{}
+	jwks.mu.Unlock()
+	for range 3 {
+		_, err = jwks.Key(context.Background(), "k")
+		require.NoError(t, err)
+	}
+	_, err = jwks.Key(context.Background(), "unknown")
+	assert.ErrorContains(t, err, "unknown key id")
+	assert.Equal(t, int32(2), requests.Load())
+
+	// Without cached keys the last error is reported.
+	empty := NewJWKS(server.URL)
+	for range 3 {
+		_, err = empty.Key(context.Background(), "k")
+		assert.ErrorContains(t, err, "unexpected status 500")
+	}
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestJWKS_ConcurrentFetch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{rsaJWK("k", &key.PublicKey)}})
+	}))
+	t.Cleanup(server.Close)
+	jwks := NewJWKS(server.URL)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Go(func() {
+			_, err := jwks.Key(context.Background(), "k")
+			errs <- err
+		})
+	}
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+
+	// The lock is not held during the fetch.
+	assert.False(t, jwks.loaded())
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), requests.Load(), "callers share one fetch")
+}
+
+func TestJWKS_CancelledCaller(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{rsaJWK("k", &key.PublicKey)}})
+	}))
+	t.Cleanup(server.Close)
+	jwks := NewJWKS(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = jwks.Key(ctx, "k")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The fetch outlives the caller that started it.
+	_, err = jwks.Key(context.Background(), "k")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestJWKS_KeyTypes(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecPoint, err := ecKey.PublicKey.Bytes()
+	require.NoError(t, err)
+
+	server := newTestJWKSServer(t,
+		map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecPoint[1:33]), "y": b64(ecPoint[33:])},
+		map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPub)},
+		map[string]string{"kty": "oct", "kid": "skipped", "k": "c2VjcmV0"},
+	)
+	verifier := NewJWTVerifier(JWTConfig{Keys: NewJWKS(server.URL)})
+
+	_, err = verifier.Verify(context.Background(), signJWT(t, AlgES256, "ec", ecKey, validClaims()))
+	assert.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), signJWT(t, AlgEdDSA, "ed", edKey, validClaims()))
+	assert.NoError(t, err)
+}
+
+func TestJWTAuthMiddleware(t *testing.T) {
+	secret := []byte("hmac-secret")
+	handler := JWTAuthMiddleware(JWTConfig{HMACSecret: secret})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := GetUser(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, "123", user.ID)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, AlgHS256, "", secret, validClaims()))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+signJWT(t, AlgHS256, "", []byte("wrong"), validClaims()))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
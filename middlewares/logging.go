@@ -1,11 +1,18 @@
 package middlewares
 
 import (
+	"bufio"
+	"context"
+	"net"
 	"net/http"
 
+	"github.com/salahfarzin/utils/tracing"
 	"go.uber.org/zap"
 )
 
+// statusRecorder records the response status. It passes Flush and Hijack
+// through and supports http.ResponseController, so streaming responses and
+// WebSocket upgrades keep working behind it.
 type statusRecorder struct {
 	http.ResponseWriter
 	status int
@@ -16,19 +23,54 @@ func (rec *statusRecorder) WriteHeader(code int) {
 	rec.ResponseWriter.WriteHeader(code)
 }
 
+func (rec *statusRecorder) Flush() {
+	_ = http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rec.ResponseWriter).Hijack()
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+type requestLogKey struct{}
+
+// requestLog collects fields that middlewares running inside
+// LoggingMiddleware learn about the request.
+type requestLog struct {
+	tenantID string
+}
+
+// setLoggedTenant records the validated tenant for LoggingMiddleware.
+func setLoggedTenant(ctx context.Context, tenantID string) {
+	if l, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		l.tenantID = tenantID
+	}
+}
+
 func LoggingMiddleware(logger *zap.Logger, level string) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			rec := &statusRecorder{ResponseWriter: w, status: 200}
-			next.ServeHTTP(rec, r)
+			// The tenant comes from the context, never from the raw header:
+			// TenantMiddleware either ran outside this middleware or records
+			// it through setLoggedTenant.
+			info := &requestLog{tenantID: tracing.GetTenantIDFromContext(r.Context())}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), requestLogKey{}, info)))
 			if level == "debug" || level == "info" {
-				logger.Info("request",
+				fields := []zap.Field{
 					zap.String("method", r.Method),
 					zap.String("path", r.URL.Path),
 					zap.String("ip", r.RemoteAddr),
 					zap.String("agent", r.Header.Get("User-Agent")),
 					zap.Int("status", rec.status),
-				)
+				}
+				if info.tenantID != "" {
+					fields = append(fields, zap.String("tenant_id", info.tenantID))
+				}
+				logger.Info("request", fields...)
 			}
 		})
 	}
@@ -4,12 +4,21 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/salahfarzin/utils/testutils"
 	"github.com/salahfarzin/utils/tracing"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -69,6 +78,7 @@ func TestCORSMiddleware_OptionsRequest(t *testing.T) {
 
 	req := httptest.NewRequest("OPTIONS", "/test", http.NoBody)
 	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -207,6 +217,7 @@ func TestGetUserFromContext_HTTP(t *testing.T) {
 }
 
 func TestGetUserFromContext_gRPC(t *testing.T) {
+	useUnsignedIdentity(t)
 	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{
 		"x-user-id":    []string{"grpc-123"},
 		"x-user-uuid":  []string{"grpc-uuid-123"},
@@ -306,6 +317,41 @@ func TestTracingMiddleware(t *testing.T) {
 	assert.Equal(t, "existing-trace-id", w.Header().Get("X-Trace-Id"))
 }
 
+func TestTracingMiddleware_UUIDTraceID(t *testing.T) {
+	var traceID, forwarded string
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = tracing.GetTraceIDFromContext(r.Context())
+		forwarded = r.Header.Get("traceparent")
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("X-Trace-Id", "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736", traceID, "the legacy ID is kept as sent")
+	assert.Contains(t, forwarded, "-4bf92f3577b34da6a3ce929d0e0e4736-", "traceparent carries the normalized ID")
+	assert.Equal(t, traceID, w.Header().Get("X-Trace-Id"))
+}
+
+func TestTracingMiddleware_Traceparent(t *testing.T) {
+	var tc tracing.TraceContext
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc, _ = tracing.TraceContextFromContext(r.Context())
+		assert.Equal(t, tc.Traceparent(), r.Header.Get("traceparent"), "forwarded traceparent names this span as parent")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", tc.ParentSpanID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get("X-Trace-Id"))
+}
+
 func TestRecoveryMiddleware(t *testing.T) {
 	testutils.InitLogger(t)
 	handler := RecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -322,3 +368,426 @@ func TestRecoveryMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Contains(t, w.Body.String(), "Internal Server Error")
 }
+
+func TestCORSMiddlewareFunc_LiveOrigins(t *testing.T) {
+	origins := []string{"http://localhost:3000"}
+	handler := CORSMiddlewareFunc(func() []string { return origins })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Origin", "https://app.example.com")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+
+	origins = append(origins, "https://app.example.com")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSWithConfig_Preflight(t *testing.T) {
+	middleware := CORSWithConfig(CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "PATCH"},
+		AllowedHeaders: []string{"Content-Type", "X-Request-Id"},
+		ExposedHeaders: []string{"X-Trace-Id"},
+		MaxAge:         10 * time.Minute,
+	})
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called for a preflight request")
+	}))
+
+	req := httptest.NewRequest("OPTIONS", "/test", http.NoBody)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
+	req.Header.Set("Access-Control-Request-Headers", "content-type, x-request-id, x-forbidden")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PATCH", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, x-request-id", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+	assert.Contains(t, w.Header().Values("Vary"), "Access-Control-Request-Headers")
+}
+
+func TestCORSWithConfig_ActualRequest(t *testing.T) {
+	middleware := CORSWithConfig(CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		ExposedHeaders:   []string{"X-Trace-Id", "X-User-Id"},
+		AllowCredentials: true,
+	})
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Trace-Id, X-User-Id", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+}
+
+func TestCORSWithConfig_AnyHeader(t *testing.T) {
+	middleware := CORSWithConfig(CORSConfig{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedHeaders: []string{"*"},
+	})
+	handler := middleware(http.NotFoundHandler())
+
+	req := httptest.NewRequest("OPTIONS", "/test", http.NoBody)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "X-Custom", w.Header().Get("Access-Control-Allow-Headers"))
+}
+
+func TestCORSWithConfig_OriginPatterns(t *testing.T) {
+	middleware := CORSWithConfig(CORSConfig{
+		AllowedOrigins: []string{
+			"https://exact.com",
+			"*.preview.example.com",
+			"https://*.app.example.com",
+			`regex:^https://pr-\d{1,5}\.example\.org$`,
+			`regex:https://(staging|qa)\.example\.net`,
+		},
+		AllowOriginFunc: func(origin string) bool {
+			return origin == "https://callback.com"
+		},
+		AllowCredentials: true,
+	})
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "https://exact.com", allowed: true},
+		{origin: "http://pr-1.preview.example.com", allowed: true},
+		{origin: "https://a.b.preview.example.com", allowed: true},
+		{origin: "https://preview.example.com", allowed: false},
+		{origin: "https://pr-123.app.example.com", allowed: true},
+		{origin: "http://pr-123.app.example.com", allowed: false},
+		{origin: "https://evilapp.example.com", allowed: false},
+		{origin: "https://pr-42.example.org", allowed: true},
+		{origin: "https://pr-42.example.org.evil.com", allowed: false},
+		{origin: "https://qa.example.net", allowed: true},
+		{origin: "https://qa.example.net.evil.com", allowed: false},
+		{origin: "https://evil.com/https://staging.example.net", allowed: false},
+		{origin: "https://callback.com", allowed: true},
+		{origin: "https://evil.com", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", http.NoBody)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			want := ""
+			if tt.allowed {
+				want = tt.origin
+			}
+			assert.Equal(t, want, w.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestCORSWithConfig_AnyOrigin(t *testing.T) {
+	handler := CORSWithConfig(CORSConfig{AllowedOrigins: []string{"*"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Origin", "https://anything.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSConfig_Validate(t *testing.T) {
+	assert.ErrorIs(t, CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}.Validate(), ErrCORSWildcardCredentials)
+	assert.Error(t, CORSConfig{AllowedOrigins: []string{"regex:("}}.Validate())
+	assert.Error(t, CORSConfig{AllowedOrigins: []string{"https://app.*.com"}}.Validate())
+	assert.NoError(t, CORSConfig{AllowedOrigins: []string{"*"}}.Validate())
+
+	var handler http.Handler
+	require.NotPanics(t, func() {
+		handler = CORSMiddleware([]string{"*", "http://localhost:3000"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	})
+	for origin, want := range map[string]string{"https://evil.com": "", "http://localhost:3000": "http://localhost:3000"} {
+		req := httptest.NewRequest("GET", "/test", http.NoBody)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Header().Get("Access-Control-Allow-Origin"), origin)
+	}
+}
+
+func TestCORSMiddlewareFunc_IgnoresWildcardWithCredentials(t *testing.T) {
+	handler := CORSMiddlewareFunc(func() []string { return []string{"*", "regex:("} })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSMiddleware_NonPreflightOptions(t *testing.T) {
+	called := false
+	handler := CORSMiddleware([]string{"http://localhost:3000"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, origin := range []string{"", "http://localhost:3000"} {
+		called = false
+		req := httptest.NewRequest("OPTIONS", "/test", http.NoBody)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		assert.True(t, called, "OPTIONS without Access-Control-Request-Method should reach the handler")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "GET, OPTIONS", w.Header().Get("Allow"))
+	}
+}
+
+func TestCORSWithConfig_DisallowedPreflight(t *testing.T) {
+	preflight := func() *http.Request {
+		req := httptest.NewRequest("OPTIONS", "/test", http.NoBody)
+		req.Header.Set("Origin", "https://evil.com")
+		req.Header.Set("Access-Control-Request-Method", "DELETE")
+		return req
+	}
+
+	t.Run("Pass through", func(t *testing.T) {
+		called := false
+		handler := CORSMiddleware([]string{"http://localhost:3000"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, preflight())
+
+		assert.True(t, called)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		core, logs := observer.New(zap.WarnLevel)
+		cfg := DefaultCORSConfig([]string{"http://localhost:3000"})
+		cfg.RejectDisallowedOrigins = true
+		cfg.Logger = zap.New(core)
+		handler := CORSWithConfig(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("Handler should not be called")
+		}))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, preflight())
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "origin not allowed")
+		assert.Equal(t, 1, logs.FilterField(zap.String("origin", "https://evil.com")).Len())
+	})
+}
+
+func TestCORSWithConfig_PreflightMethodValidation(t *testing.T) {
+	handler := CORSMiddleware([]string{"http://localhost:3000"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler should not be called for a preflight request")
+	}))
+
+	tests := []struct {
+		method string
+		want   int
+	}{
+		{method: "DELETE", want: http.StatusNoContent},
+		{method: "HEAD", want: http.StatusNoContent},
+		{method: "PATCH", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/test", http.NoBody)
+			req.Header.Set("Origin", "http://localhost:3000")
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestTracingMiddleware_ServerSpan(t *testing.T) {
+	rec := tracing.NewRecorder()
+	tracing.SetSpanProcessor(rec)
+	t.Cleanup(func() { tracing.SetSpanProcessor(nil) })
+
+	var child *tracing.Span
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, child = tracing.StartSpan(r.Context(), "load")
+		child.End()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	req := httptest.NewRequest("GET", "/orders", http.NoBody)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Len(t, rec.Ended(), 2)
+	server := rec.Find("GET /orders")
+	assert.Equal(t, "GET /orders", server.Name())
+	assert.Equal(t, tracing.SpanKindServer, server.Kind())
+	assert.Equal(t, "00f067aa0ba902b7", server.Context().ParentSpanID)
+	assert.Equal(t, server.Context().SpanID, child.Context().ParentSpanID)
+	assert.Equal(t, http.StatusBadGateway, server.Attributes()["http.status_code"])
+	status, _ := server.Status()
+	assert.Equal(t, tracing.StatusError, status)
+}
+
+func TestTracingMiddleware_Streaming(t *testing.T) {
+	handler := CreateStack(LoggingMiddleware(zap.NewNop(), "info"), TracingMiddleware)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok, "the writer should still be an http.Flusher")
+		_, _ = w.Write([]byte("event: ping\n\n"))
+		flusher.Flush()
+		assert.NoError(t, http.NewResponseController(w).Flush())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/events", http.NoBody))
+	assert.True(t, w.Flushed)
+
+	server := httptest.NewServer(TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		_ = buf.Flush()
+	})))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+}
+
+func TestTracingMiddleware_OTelServerSpan(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp), sdktrace.WithIDGenerator(tracing.OTelIDGenerator{}))
+	tracing.SetTracerProvider(tp)
+	t.Cleanup(func() { tracing.SetTracerProvider(nil) })
+
+	var traceID string
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = tracing.GetTraceIDFromContext(r.Context())
+		assert.Equal(t, oteltrace.SpanContextFromContext(r.Context()).SpanID().String(),
+			r.Header.Get("traceparent")[36:52], "downstream calls name the OTel span as parent")
+	}))
+
+	req := httptest.NewRequest("GET", "/orders", http.NoBody)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /orders", spans[0].Name)
+	assert.Equal(t, oteltrace.SpanKindServer, spans[0].SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, traceID, w.Header().Get("X-Trace-Id"))
+}
+
+func TestTracingMiddleware_Sampling(t *testing.T) {
+	rec := tracing.NewRecorder()
+	tracing.SetSpanProcessor(rec)
+	tracing.SetSampler(tracing.ParentBased(tracing.RouteSampler([]tracing.RouteRule{
+		{Path: "/healthz", Sampler: tracing.NeverSample()},
+	}, tracing.AlwaysSample())))
+	t.Cleanup(func() {
+		tracing.SetSpanProcessor(nil)
+		tracing.SetSampler(nil)
+	})
+
+	var forwarded string
+	handler := TracingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("traceparent")
+	}))
+	serve := func(path, traceparent string) {
+		req := httptest.NewRequest("GET", path, http.NoBody)
+		if traceparent != "" {
+			req.Header.Set("traceparent", traceparent)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("/healthz", "")
+	assert.True(t, strings.HasSuffix(forwarded, "-00"), "the decision is forwarded downstream")
+	assert.Empty(t, rec.Ended())
+
+	serve("/orders", "")
+	assert.True(t, strings.HasSuffix(forwarded, "-01"))
+	assert.NotNil(t, rec.Find("GET /orders"))
+
+	rec.Reset()
+	serve("/orders", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, strings.HasSuffix(forwarded, "-00"), "an unsampled caller is honoured")
+	assert.Empty(t, rec.Ended())
+}
+
+func TestTracingUnaryClientInterceptor(t *testing.T) {
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	tc := tracing.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	ctx := tracing.InjectTraceContext(context.Background(), tc)
+	require.NoError(t, TracingUnaryClientInterceptor()(ctx, "/svc/Method", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"}, outgoing.Get("traceparent"))
+}
@@ -0,0 +1,196 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrUserInactive = errors.New("user account is inactive")
+
+var (
+	errNoUser          = errors.New("auth service returned no user")
+	errRevocationCheck = errors.New("failed to check revocation")
+)
+
+// RevocationStore records revoked tokens and users. Entries only need to be
+// kept until the tokens they cover would have expired anyway.
+type RevocationStore interface {
+	// RevokeToken rejects the token with the given hash (see HashToken)
+	// until expiresAt.
+	RevokeToken(ctx context.Context, tokenHash string, expiresAt time.Time) error
+	// RevokeUser rejects the user's tokens issued at or before revokedAt,
+	// e.g. on logout from all devices; tokens issued afterwards are accepted.
+	// The entry may be dropped after until, once those tokens have expired.
+	RevokeUser(ctx context.Context, userID string, revokedAt, until time.Time) error
+	// BanUser rejects every token of the user, including new ones, until the
+	// given time.
+	BanUser(ctx context.Context, userID string, until time.Time) error
+	// IsRevoked reports whether the token is revoked, its user is banned, or
+	// it was issued at or before a revocation of its user. A zero issuedAt
+	// counts as issued before any revocation.
+	IsRevoked(ctx context.Context, tokenHash, userID string, issuedAt time.Time) (bool, error)
+}
+
+// HashToken returns the hex SHA-256 hash that identifies a token in a
+// RevocationStore, so stores never hold usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkUser rejects inactive users and revoked tokens after the token itself
+// was validated.
+func checkUser(ctx context.Context, store RevocationStore, token string, user *User) error {
+	if user.IsActive != nil && !*user.IsActive {
+		return ErrUserInactive
+	}
+	if store == nil {
+		return nil
+	}
+	revoked, err := store.IsRevoked(ctx, HashToken(token), user.ID, user.IssuedAt)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errRevocationCheck, err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// Revocation event types.
+const (
+	RevokeTokenEvent = "token"
+	RevokeUserEvent  = "user"
+	BanUserEvent     = "ban"
+)
+
+// RevocationEvent announces a revocation to other instances, e.g. over Kafka.
+type RevocationEvent struct {
+	Type      string `json:"type"`
+	TokenHash string `json:"token_hash,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	// RevokedAt is required for RevokeUserEvent; see RevocationStore.RevokeUser.
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Apply records the event in store.
+func (e RevocationEvent) Apply(ctx context.Context, store RevocationStore) error {
+	switch e.Type {
+	case RevokeTokenEvent:
+		if e.TokenHash == "" {
+			return errors.New("revocation event without token_hash")
+		}
+		return store.RevokeToken(ctx, e.TokenHash, e.ExpiresAt)
+	case RevokeUserEvent, BanUserEvent:
+		if e.UserID == "" {
+			return errors.New("revocation event without user_id")
+		}
+		if e.Type == BanUserEvent {
+			return store.BanUser(ctx, e.UserID, e.ExpiresAt)
+		}
+		if e.RevokedAt.IsZero() {
+			return errors.New("revocation event without revoked_at")
+		}
+		return store.RevokeUser(ctx, e.UserID, e.RevokedAt, e.ExpiresAt)
+	}
+	return fmt.Errorf("unknown revocation event type %q", e.Type)
+}
+
+// MemoryRevocationStore is an in-memory RevocationStore. Expired entries are
+// dropped as they are encountered.
+type MemoryRevocationStore struct {
+	// Now returns the current time; defaults to time.Now.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	bans   map[string]time.Time
+	users  map[string]userRevocation
+}
+
+type userRevocation struct {
+	revokedAt time.Time
+	until     time.Time
+}
+
+// NewMemoryRevocationStore creates an empty MemoryRevocationStore.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		Now:    time.Now,
+		tokens: make(map[string]time.Time),
+		bans:   make(map[string]time.Time),
+		users:  make(map[string]userRevocation),
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(_ context.Context, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revokeUntil(s.tokens, tokenHash, expiresAt)
+	return nil
+}
+
+// RevokeUser never moves an existing revocation back in time.
+func (s *MemoryRevocationStore) RevokeUser(_ context.Context, userID string, revokedAt, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.users[userID]
+	if revokedAt.After(entry.revokedAt) {
+		entry.revokedAt = revokedAt
+	}
+	if until.After(entry.until) {
+		entry.until = until
+	}
+	s.users[userID] = entry
+	return nil
+}
+
+func (s *MemoryRevocationStore) BanUser(_ context.Context, userID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revokeUntil(s.bans, userID, until)
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, tokenHash, userID string, issuedAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.Now()
+	if revokedAt(s.tokens, tokenHash, now) || revokedAt(s.bans, userID, now) {
+		return true, nil
+	}
+	entry, ok := s.users[userID]
+	if !ok {
+		return false, nil
+	}
+	if !now.Before(entry.until) {
+		delete(s.users, userID)
+		return false, nil
+	}
+	return !issuedAt.After(entry.revokedAt), nil
+}
+
+// revokeUntil never shortens an existing revocation.
+func revokeUntil(entries map[string]time.Time, key string, until time.Time) {
+	if current, ok := entries[key]; !ok || until.After(current) {
+		entries[key] = until
+	}
+}
+
+func revokedAt(entries map[string]time.Time, key string, now time.Time) bool {
+	until, ok := entries[key]
+	if !ok {
+		return false
+	}
+	if !now.Before(until) {
+		delete(entries, key)
+		return false
+	}
+	return true
+}
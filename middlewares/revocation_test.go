@@ -0,0 +1,172 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	store := NewMemoryRevocationStore()
+	store.Now = clock.Now
+	before, after := clock.now.Add(-time.Minute), clock.now.Add(time.Minute)
+
+	require.NoError(t, store.RevokeToken(ctx, HashToken("token-1"), clock.now.Add(time.Hour)))
+	require.NoError(t, store.BanUser(ctx, "user-2", clock.now.Add(2*time.Hour)))
+	require.NoError(t, store.BanUser(ctx, "user-2", clock.now.Add(time.Minute)), "shorter bans are ignored")
+
+	revoked, err := store.IsRevoked(ctx, HashToken("token-1"), "user-1", before)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, HashToken("token-2"), "user-2", after)
+	assert.True(t, revoked, "bans reject new tokens too")
+	revoked, _ = store.IsRevoked(ctx, HashToken("token-2"), "user-1", before)
+	assert.False(t, revoked)
+
+	clock.Advance(90 * time.Minute)
+	revoked, _ = store.IsRevoked(ctx, HashToken("token-1"), "user-1", before)
+	assert.False(t, revoked, "token revocation expired")
+	revoked, _ = store.IsRevoked(ctx, HashToken("token-2"), "user-2", after)
+	assert.True(t, revoked)
+}
+
+func TestMemoryRevocationStore_RevokeUser(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	store := NewMemoryRevocationStore()
+	store.Now = clock.Now
+	revokedAt := clock.now
+
+	require.NoError(t, store.RevokeUser(ctx, "user-1", revokedAt, revokedAt.Add(time.Hour)))
+	require.NoError(t, store.RevokeUser(ctx, "user-1", revokedAt.Add(-time.Hour), revokedAt.Add(time.Minute)),
+		"older revocations are ignored")
+
+	revoked, _ := store.IsRevoked(ctx, "", "user-1", revokedAt.Add(-time.Second))
+	assert.True(t, revoked, "tokens issued before the revocation are rejected")
+	revoked, _ = store.IsRevoked(ctx, "", "user-1", revokedAt)
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, "", "user-1", time.Time{})
+	assert.True(t, revoked, "tokens without iat are rejected")
+	revoked, _ = store.IsRevoked(ctx, "", "user-1", revokedAt.Add(time.Second))
+	assert.False(t, revoked, "logging in again works")
+
+	clock.Advance(2 * time.Hour)
+	revoked, _ = store.IsRevoked(ctx, "", "user-1", time.Time{})
+	assert.False(t, revoked, "the entry is dropped once old tokens have expired")
+}
+
+func TestRevocationEvent_Apply(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRevocationStore()
+	now := time.Now()
+	until := now.Add(time.Hour)
+
+	require.NoError(t, RevocationEvent{Type: RevokeTokenEvent, TokenHash: HashToken("t"), ExpiresAt: until}.Apply(ctx, store))
+	require.NoError(t, RevocationEvent{Type: RevokeUserEvent, UserID: "u", RevokedAt: now, ExpiresAt: until}.Apply(ctx, store))
+	require.NoError(t, RevocationEvent{Type: BanUserEvent, UserID: "b", ExpiresAt: until}.Apply(ctx, store))
+	revoked, _ := store.IsRevoked(ctx, HashToken("t"), "", now)
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, "", "u", now.Add(-time.Minute))
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, "", "u", now.Add(time.Minute))
+	assert.False(t, revoked)
+	revoked, _ = store.IsRevoked(ctx, "", "b", now.Add(time.Minute))
+	assert.True(t, revoked)
+
+	assert.Error(t, RevocationEvent{Type: RevokeTokenEvent}.Apply(ctx, store))
+	assert.Error(t, RevocationEvent{Type: RevokeUserEvent, UserID: "u", ExpiresAt: until}.Apply(ctx, store), "revoked_at is required")
+	assert.Error(t, RevocationEvent{Type: "session"}.Apply(ctx, store))
+}
+
+type failingRevocationStore struct {
+	RevocationStore
+}
+
+func (failingRevocationStore) IsRevoked(context.Context, string, string, time.Time) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestAuthMiddleware_Revocation(t *testing.T) {
+	inactive := false
+	revokedAt := time.Now()
+	authService := func(token string) (*User, error) {
+		if token == "inactive-token" {
+			return &User{ID: "3", IsActive: &inactive}, nil
+		}
+		// Tokens named "new-..." were issued after user 2 logged out everywhere.
+		issuedAt := revokedAt.Add(-time.Minute)
+		if strings.HasPrefix(token, "new-") {
+			issuedAt = revokedAt.Add(time.Minute)
+		}
+		return &User{ID: token[len(token)-1:], IssuedAt: issuedAt}, nil
+	}
+	store := NewMemoryRevocationStore()
+	ctx := context.Background()
+	require.NoError(t, store.RevokeToken(ctx, HashToken("logged-out-token-1"), time.Now().Add(time.Hour)))
+	require.NoError(t, store.RevokeUser(ctx, "2", revokedAt, revokedAt.Add(time.Hour)))
+	require.NoError(t, store.BanUser(ctx, "4", time.Now().Add(time.Hour)))
+
+	tests := []struct {
+		name   string
+		store  RevocationStore
+		token  string
+		status int
+		code   string
+	}{
+		{name: "Valid", store: store, token: "valid-token-1", status: http.StatusOK},
+		{name: "Revoked token", store: store, token: "logged-out-token-1", status: http.StatusUnauthorized, code: AuthErrTokenRevoked},
+		{name: "Revoked user", store: store, token: "other-token-2", status: http.StatusUnauthorized, code: AuthErrTokenRevoked},
+		{name: "Token issued after user revocation", store: store, token: "new-token-2", status: http.StatusOK},
+		{name: "Banned user", store: store, token: "new-token-4", status: http.StatusUnauthorized, code: AuthErrTokenRevoked},
+		{name: "Inactive user", store: store, token: "inactive-token", status: http.StatusUnauthorized, code: AuthErrUserInactive},
+		{name: "Inactive user without store", token: "inactive-token", status: http.StatusUnauthorized, code: AuthErrUserInactive},
+		{name: "Store failure", store: failingRevocationStore{}, token: "valid-token-1", status: http.StatusServiceUnavailable, code: AuthErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := AuthMiddlewareWithConfig(AuthConfig{AuthService: authService, Revocations: tt.store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest("GET", "/test", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				assert.Contains(t, w.Body.String(), `"code":"`+tt.code+`"`)
+			}
+		})
+	}
+}
+
+func TestGRPCAuth_Revocation(t *testing.T) {
+	store := NewMemoryRevocationStore()
+	require.NoError(t, store.RevokeToken(context.Background(), HashToken("revoked"), time.Now().Add(time.Hour)))
+	cfg := GRPCAuthConfig{
+		AuthService: func(string) (*User, error) { return &User{ID: "1"}, nil },
+		Revocations: store,
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer revoked"))
+	_, err := cfg.authenticate(ctx, "/svc/Method")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	cfg.Revocations = failingRevocationStore{}
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer valid"))
+	_, err = cfg.authenticate(ctx, "/svc/Method")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -0,0 +1,94 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/salahfarzin/utils/rest"
+	"github.com/salahfarzin/utils/tracing"
+	"google.golang.org/grpc"
+)
+
+// TenantConfig configures TenantMiddleware. The tenant is taken from the
+// header, then the subdomain, then the authenticated user's TenantID.
+type TenantConfig struct {
+	// Header names the tenant header; defaults to tracing.TenantIDHeader.
+	Header string
+	// BaseDomain enables subdomain extraction: with "example.com", requests
+	// to acme.example.com belong to tenant "acme".
+	BaseDomain string
+	// Required rejects requests without a tenant with 400.
+	Required bool
+}
+
+// TenantMiddleware resolves the tenant of a request and stores it with
+// tracing.InjectTenantIDToContext. It must run after AuthMiddleware: a user
+// with a TenantID may only act within that tenant, and other tenants get 403.
+// The request header is left as sent; read the tenant with
+// tracing.GetTenantIDFromContext.
+func TenantMiddleware(cfg TenantConfig) Middleware {
+	if cfg.Header == "" {
+		cfg.Header = tracing.TenantIDHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenantID := r.Header.Get(cfg.Header)
+			if tenantID == "" && cfg.BaseDomain != "" {
+				tenantID = subdomain(r.Host, cfg.BaseDomain)
+			}
+
+			if user, ok := GetUser(r.Context()); ok && user != nil && user.TenantID != "" {
+				if tenantID != "" && tenantID != user.TenantID {
+					rest.WriteJSONErrorCode(w, http.StatusForbidden, "tenant_mismatch", "forbidden", tracing.GetTraceIDFromContext(r.Context()))
+					return
+				}
+				tenantID = user.TenantID
+			}
+
+			if tenantID == "" {
+				if cfg.Required {
+					rest.WriteJSONErrorCode(w, http.StatusBadRequest, "missing_tenant", "missing tenant", tracing.GetTraceIDFromContext(r.Context()))
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setLoggedTenant(r.Context(), tenantID)
+			next.ServeHTTP(w, r.WithContext(tracing.InjectTenantIDToContext(r.Context(), tenantID)))
+		})
+	}
+}
+
+// subdomain returns the label directly below baseDomain in host, or "".
+func subdomain(host, baseDomain string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	prefix, ok := strings.CutSuffix(host, "."+strings.ToLower(baseDomain))
+	if !ok || prefix == "" {
+		return ""
+	}
+	if i := strings.LastIndexByte(prefix, '.'); i >= 0 {
+		prefix = prefix[i+1:]
+	}
+	return prefix
+}
+
+// TenantUnaryClientInterceptor propagates the tenant of the call context to
+// the called service as gRPC metadata.
+func TenantUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(tracing.AppendTenantIDToOutgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// TenantStreamClientInterceptor is TenantUnaryClientInterceptor for streams.
+func TenantStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(tracing.AppendTenantIDToOutgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
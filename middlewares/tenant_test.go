@@ -0,0 +1,126 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/salahfarzin/utils/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    TenantConfig
+		host   string
+		header string
+		user   *User
+		status int
+		tenant string
+	}{
+		{name: "Header", header: "acme", status: http.StatusOK, tenant: "acme"},
+		{name: "Subdomain", cfg: TenantConfig{BaseDomain: "example.com"}, host: "acme.example.com:8080", status: http.StatusOK, tenant: "acme"},
+		{name: "Nested subdomain", cfg: TenantConfig{BaseDomain: "example.com"}, host: "api.acme.example.com", status: http.StatusOK, tenant: "acme"},
+		{name: "Header wins over subdomain", cfg: TenantConfig{BaseDomain: "example.com"}, host: "acme.example.com", header: "globex", status: http.StatusOK, tenant: "globex"},
+		{name: "Other domain", cfg: TenantConfig{BaseDomain: "example.com"}, host: "acme.example.org", status: http.StatusOK},
+		{name: "User claim", user: &User{ID: "1", TenantID: "acme"}, status: http.StatusOK, tenant: "acme"},
+		{name: "User claim matches header", header: "acme", user: &User{ID: "1", TenantID: "acme"}, status: http.StatusOK, tenant: "acme"},
+		{name: "User claim mismatch", header: "globex", user: &User{ID: "1", TenantID: "acme"}, status: http.StatusForbidden},
+		{name: "Required", cfg: TenantConfig{Required: true}, status: http.StatusBadRequest},
+		{name: "Optional", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := TenantMiddleware(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = tracing.GetTenantIDFromContext(r.Context())
+				assert.Equal(t, tt.header, r.Header.Get(tracing.TenantIDHeader), "the header is not rewritten")
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/test", http.NoBody)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Tenant-Id", tt.header)
+			}
+			if tt.user != nil {
+				req = req.WithContext(context.WithValue(req.Context(), UserKey, tt.user))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.tenant, got)
+		})
+	}
+}
+
+func TestLoggingMiddleware_Tenant(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	handler := LoggingMiddleware(zap.New(core), "info")(TenantMiddleware(TenantConfig{BaseDomain: "example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Host = "acme.example.com"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "acme", logs.All()[0].ContextMap()["tenant_id"])
+
+	// A header the tenant middleware rejected is not logged.
+	logs.TakeAll()
+	authed := LoggingMiddleware(zap.New(core), "info")(TenantMiddleware(TenantConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	req = httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set(tracing.TenantIDHeader, "globex")
+	req = req.WithContext(context.WithValue(req.Context(), UserKey, &User{ID: "1", TenantID: "acme"}))
+	authed.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Equal(t, 1, logs.Len())
+	assert.NotContains(t, logs.All()[0].ContextMap(), "tenant_id")
+
+	// Without TenantMiddleware the raw header is not trusted either.
+	logs.TakeAll()
+	plain := LoggingMiddleware(zap.New(core), "info")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req = httptest.NewRequest("GET", "/test", http.NoBody)
+	req.Header.Set(tracing.TenantIDHeader, "globex")
+	plain.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotContains(t, logs.All()[0].ContextMap(), "tenant_id")
+}
+
+func TestTenantUnaryClientInterceptor(t *testing.T) {
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	ctx := tracing.InjectTenantIDToContext(context.Background(), "acme")
+	require.NoError(t, TenantUnaryClientInterceptor()(ctx, "/svc/Method", nil, nil, nil, invoker))
+	assert.Equal(t, []string{"acme"}, outgoing.Get("x-tenant-id"))
+}
+
+func TestGRPCAuth_Tenant(t *testing.T) {
+	cfg := GRPCAuthConfig{AuthService: func(string) (*User, error) { return &User{ID: "1", TenantID: "acme"}, nil }}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token"))
+	ctx, err := cfg.authenticate(ctx, "/svc/Method")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tracing.GetTenantIDFromContext(ctx))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer token", "x-tenant-id", "globex"))
+	_, err = cfg.authenticate(ctx, "/svc/Method")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/salahfarzin/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// TestAuthEnv enables FixtureAuthMiddleware and TestAuthMiddleware, in tests
+// and E2E environments alike: AUTH_TEST_MODE=true.
+const TestAuthEnv = "AUTH_TEST_MODE"
+
+// PersonaHeader names the persona a request authenticates as with
+// FixtureAuthMiddleware.
+const PersonaHeader = "X-Test-Persona"
+
+var (
+	ErrTestAuthDisabled = errors.New("test authentication is disabled; set " + TestAuthEnv + "=true to enable it")
+	ErrUnknownPersona   = errors.New("unknown test persona")
+)
+
+// TestAuthEnabled reports whether TestAuthEnv is true.
+func TestAuthEnabled() bool {
+	return utils.GetEnvAsBool(TestAuthEnv, false)
+}
+
+// mustAllowTestAuth stops the test authenticators from being wired into
+// production by accident.
+func mustAllowTestAuth() {
+	if !TestAuthEnabled() {
+		panic(ErrTestAuthDisabled)
+	}
+}
+
+// Personas maps persona names to the users they authenticate as.
+type Personas map[string]User
+
+// LoadPersonas reads personas from a JSON or YAML file. Users are decoded
+// with their JSON field names, so both formats share one schema:
+//
+//	admin:
+//	  id: "1"
+//	  email: admin@example.com
+//	  roles: [admin]
+//	  first_name: Ada
+func LoadPersonas(path string) (Personas, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read personas: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var doc map[string]any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse personas %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("failed to parse personas %s: %w", path, err)
+		}
+	}
+
+	var personas Personas
+	if err := json.Unmarshal(data, &personas); err != nil {
+		return nil, fmt.Errorf("failed to parse personas %s: %w", path, err)
+	}
+	return personas, nil
+}
+
+// AuthService authenticates persona names as tokens.
+func (p Personas) AuthService() AuthServiceFunc {
+	return func(name string) (*User, error) {
+		user, ok := p[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownPersona, name)
+		}
+		return cloneUser(&user), nil
+	}
+}
+
+// FixtureAuthMiddleware authenticates requests as the persona named in
+// PersonaHeader, without an external auth service. It behaves like
+// AuthMiddleware otherwise: unknown personas get 401. It panics unless
+// TestAuthEnabled.
+func FixtureAuthMiddleware(personas Personas) Middleware {
+	mustAllowTestAuth()
+	return AuthMiddlewareWithConfig(AuthConfig{
+		AuthService: personas.AuthService(),
+		Extractor:   HeaderToken(PersonaHeader),
+	})
+}
+
+// SetTestPersona makes r authenticate as persona with FixtureAuthMiddleware.
+func SetTestPersona(r *http.Request, persona string) {
+	r.Header.Set(PersonaHeader, persona)
+}
+
+// SetTestUserHeaders sets the headers TestAuthMiddleware reads for user.
+func SetTestUserHeaders(r *http.Request, user User) {
+	r.Header.Set("X-User", user.ID)
+	r.Header.Set("X-User-Uuid", user.Uuid)
+	r.Header.Set("X-User-Roles", strings.Join(user.Roles, ","))
+}
@@ -0,0 +1,108 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestAuthGuard(t *testing.T) {
+	t.Setenv(TestAuthEnv, "")
+	assert.False(t, TestAuthEnabled())
+	assert.PanicsWithValue(t, ErrTestAuthDisabled, func() { FixtureAuthMiddleware(Personas{}) })
+	assert.PanicsWithValue(t, ErrTestAuthDisabled, func() { TestAuthMiddleware() })
+
+	t.Setenv(TestAuthEnv, "true")
+	assert.True(t, TestAuthEnabled())
+	assert.NotPanics(t, func() { FixtureAuthMiddleware(Personas{}) })
+	assert.NotPanics(t, func() { TestAuthMiddleware() })
+}
+
+func TestLoadPersonas(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "personas.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`
+admin:
+  id: "1"
+  uuid: uuid-1
+  email: admin@example.com
+  roles: [admin, user]
+  first_name: Ada
+  is_active: true
+`), 0o600))
+	jsonPath := filepath.Join(dir, "personas.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"admin": {"id": "1", "uuid": "uuid-1", "email": "admin@example.com", "roles": ["admin", "user"], "first_name": "Ada", "is_active": true}}`), 0o600))
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			personas, err := LoadPersonas(path)
+			require.NoError(t, err)
+			admin := personas["admin"]
+			assert.Equal(t, "1", admin.ID)
+			assert.Equal(t, "admin@example.com", admin.Email)
+			assert.Equal(t, []string{"admin", "user"}, admin.Roles)
+			require.NotNil(t, admin.FirstName)
+			assert.Equal(t, "Ada", *admin.FirstName)
+			require.NotNil(t, admin.IsActive)
+			assert.True(t, *admin.IsActive)
+		})
+	}
+
+	_, err := LoadPersonas(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestFixtureAuthMiddleware(t *testing.T) {
+	t.Setenv(TestAuthEnv, "true")
+	first := "Grace"
+	personas := Personas{
+		"admin":  {ID: "1", Email: "admin@example.com", Roles: []string{"admin"}, FirstName: &first},
+		"viewer": {ID: "2", Email: "viewer@example.com", Roles: []string{"viewer"}},
+	}
+
+	var got User
+	handler := FixtureAuthMiddleware(personas)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUserFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	SetTestPersona(req, "admin")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "admin@example.com", got.Email)
+	require.NotNil(t, got.FirstName)
+	assert.Equal(t, "Grace", *got.FirstName)
+
+	*got.FirstName = "changed"
+	assert.Equal(t, "Grace", first, "handlers must not be able to modify fixtures")
+
+	req = httptest.NewRequest("GET", "/test", http.NoBody)
+	SetTestPersona(req, "nobody")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTestAuthMiddleware(t *testing.T) {
+	t.Setenv(TestAuthEnv, "true")
+	var got User
+	handler := TestAuthMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetUserFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/test", http.NoBody)
+	SetTestUserHeaders(req, User{ID: "7", Uuid: "uuid-7", Roles: []string{"admin", "user"}})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "7", got.ID)
+	assert.Equal(t, "uuid-7", got.Uuid)
+	assert.Equal(t, []string{"admin", "user"}, got.Roles)
+}
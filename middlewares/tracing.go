@@ -1,19 +1,52 @@
 package middlewares
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/salahfarzin/utils/tracing"
+	"google.golang.org/grpc"
 )
 
 // TracingMiddleware extracts TraceID and UserID from headers and injects them into context.
-// It also sets the TraceID in the response header.
+// It continues the W3C trace context of the caller (traceparent/tracestate) with a new span,
+// and rewrites the request's trace headers so gRPC-Gateway forwards that span as the parent.
+// It also sets the TraceID in the response header. A legacy X-Trace-Id is echoed and put
+// in the context as sent; only traceparent carries its normalized 32-hex-digit form.
+//
+// Each request is recorded as a server span named "METHOD /path"; handlers can
+// start child spans with tracing.StartSpan. Responses with a 5xx status mark
+// the span as failed. After tracing.SetTracerProvider the span is also an
+// OpenTelemetry server span.
+//
+// The span is recorded only if the tracing.Sampler set with tracing.SetSampler
+// says so; the decision is forwarded in the sampled flag of traceparent.
 func TracingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.StartSpan(r.Context(), r.Method+" "+r.URL.Path,
+			tracing.WithSpanKind(tracing.SpanKindServer),
+			tracing.WithTraceContext(tracing.TraceContextFromHeader(r)),
+			tracing.WithAttributes(map[string]any{
+				"http.method": r.Method,
+				"url.path":    r.URL.Path,
+			}),
+		)
+		defer span.End()
+		// With tracing.SetTracerProvider the span carries the IDs chosen by OpenTelemetry.
+		tc := span.Context()
+
+		// X-Trace-Id is kept as an alias: callers without traceparent get back the ID they sent,
+		// even if it is not a valid W3C trace ID.
 		traceID := tracing.GetOrGenerateTraceIDFromHeader(r)
+		if r.Header.Get("X-Trace-Id") == "" {
+			traceID = tc.TraceID
+		}
 		userID := tracing.GetUserIDFromHeader(r)
 
-		ctx := r.Context()
+		tracing.SetTraceContextHeaders(r.Header, tc)
+		r.Header.Set("X-Trace-Id", traceID)
+
 		ctx = tracing.InjectTraceIDToContext(ctx, traceID)
 		if userID != "" {
 			ctx = tracing.InjectUserIDToContext(ctx, userID)
@@ -24,6 +57,27 @@ func TracingMiddleware(next http.Handler) http.Handler {
 			tracing.SetUserIDHeader(w, userID)
 		}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", rec.status)
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(tracing.StatusError, strconv.Itoa(rec.status)+" "+http.StatusText(rec.status))
+		}
 	})
 }
+
+// TracingUnaryClientInterceptor propagates the trace context of the call,
+// including the sampling decision, to the called service as gRPC metadata.
+func TracingUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(tracing.AppendTraceContextToOutgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// TracingStreamClientInterceptor is TracingUnaryClientInterceptor for streams.
+func TracingStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(tracing.AppendTraceContextToOutgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
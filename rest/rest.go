@@ -7,12 +7,19 @@ import (
 
 type ErrorResponse struct {
 	Error   string `json:"error"`
+	Code    string `json:"code,omitempty"`
 	TraceID string `json:"trace_id,omitempty"`
 }
 
 // WriteJSONError writes a standardized JSON error response for REST APIs.
 func WriteJSONError(w http.ResponseWriter, status int, errMsg, traceID string) {
+	WriteJSONErrorCode(w, status, "", errMsg, traceID)
+}
+
+// WriteJSONErrorCode is WriteJSONError with a machine-readable error code,
+// such as "token_expired", for clients to act on.
+func WriteJSONErrorCode(w http.ResponseWriter, status int, code, errMsg, traceID string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: errMsg, TraceID: traceID})
+	json.NewEncoder(w).Encode(ErrorResponse{Error: errMsg, Code: code, TraceID: traceID})
 }
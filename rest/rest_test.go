@@ -22,3 +22,17 @@ func TestWriteJSONError(t *testing.T) {
 	assert.Equal(t, "unauthorized access", resp.Error)
 	assert.Equal(t, "trace-123", resp.TraceID)
 }
+
+func TestWriteJSONErrorCode(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteJSONErrorCode(w, http.StatusUnauthorized, "token_expired", "token is expired", "trace-123")
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var resp ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "token_expired", resp.Code)
+	assert.Equal(t, "token is expired", resp.Error)
+	assert.Equal(t, "trace-123", resp.TraceID)
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SecretScheme prefixes values that reference a secret instead of holding it,
+// e.g. DB_PASSWORD=secret://mysql/password.
+const SecretScheme = "secret://"
+
+// ErrNoSecretResolver is returned for secret references when no resolver is set.
+var ErrNoSecretResolver = errors.New("no secret resolver configured")
+
+// Secret is a string that redacts itself when printed with fmt, logged with
+// zap or marshalled to JSON. Use Value to get the actual secret.
+type Secret string
+
+// Value returns the unredacted secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return fmt.Sprintf("utils.Secret(%q)", s.String())
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// SecretResolver resolves the part of a secret reference after SecretScheme.
+type SecretResolver interface {
+	ResolveSecret(ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to a SecretResolver.
+type SecretResolverFunc func(ref string) (string, error)
+
+func (f SecretResolverFunc) ResolveSecret(ref string) (string, error) {
+	return f(ref)
+}
+
+// DirSecretResolver resolves secret://name to the content of the file name
+// inside the directory, e.g. a mounted Kubernetes secret volume.
+type DirSecretResolver string
+
+func (d DirSecretResolver) ResolveSecret(ref string) (string, error) {
+	if !filepath.IsLocal(ref) {
+		return "", fmt.Errorf("invalid secret reference %q", ref)
+	}
+	return readSecretFile(filepath.Join(string(d), ref))
+}
+
+var (
+	secretMu       sync.RWMutex
+	secretResolver SecretResolver
+)
+
+// SetSecretResolver sets the resolver used for secret:// values.
+func SetSecretResolver(r SecretResolver) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretResolver = r
+}
+
+func resolveSecretRef(ref string) (string, error) {
+	secretMu.RLock()
+	r := secretResolver
+	secretMu.RUnlock()
+
+	if r == nil {
+		return "", ErrNoSecretResolver
+	}
+	return r.ResolveSecret(ref)
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// envValue is the result of resolving a key, following secret indirection.
+type envValue struct {
+	value  string
+	found  bool
+	secret bool
+}
+
+// resolveEnv looks up key in src. A value of the form secret://ref is
+// resolved through the SecretResolver; if key itself is not set but KEY_FILE
+// is, the value is read from that file.
+func resolveEnv(src Source, key string) (envValue, error) {
+	if v, ok := src.Lookup(key); ok {
+		ref, isRef := strings.CutPrefix(v, SecretScheme)
+		if !isRef {
+			return envValue{value: v, found: true}, nil
+		}
+		s, err := resolveSecretRef(ref)
+		if err != nil {
+			return envValue{found: true, secret: true}, fmt.Errorf("failed to resolve secret reference: %w", err)
+		}
+		return envValue{value: s, found: true, secret: true}, nil
+	}
+
+	if path, ok := src.Lookup(key + "_FILE"); ok && path != "" {
+		s, err := readSecretFile(path)
+		if err != nil {
+			return envValue{found: true, secret: true}, err
+		}
+		return envValue{value: s, found: true, secret: true}, nil
+	}
+
+	return envValue{}, nil
+}
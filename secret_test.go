@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func useSecretResolver(t *testing.T, r SecretResolver) {
+	t.Helper()
+	SetSecretResolver(r)
+	t.Cleanup(func() { SetSecretResolver(nil) })
+}
+
+func TestSecret_Redaction(t *testing.T) {
+	s := Secret("hunter2")
+
+	for _, out := range []string{
+		fmt.Sprint(s),
+		fmt.Sprintf("%s %v %+v %q %#v", s, s, s, s, s),
+		fmt.Sprintf("%v", struct{ Password Secret }{s}),
+	} {
+		if strings.Contains(out, "hunter2") {
+			t.Errorf("fmt output leaks the secret: %s", out)
+		}
+	}
+
+	data, err := json.Marshal(map[string]Secret{"password": s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"password":"[REDACTED]"}` {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	core, logs := observer.New(zap.InfoLevel)
+	zap.New(core).Info("connecting", zap.Any("password", s), zap.Stringer("secret", s))
+	for k, v := range logs.All()[0].ContextMap() {
+		if v != redacted {
+			t.Errorf("zap field %s = %v, want %s", k, v, redacted)
+		}
+	}
+
+	if s.Value() != "hunter2" {
+		t.Errorf("Value() = %q, want hunter2", s.Value())
+	}
+	if Secret("").String() != "" {
+		t.Errorf("empty Secret should print empty")
+	}
+}
+
+func TestSecret_FileIndirection(t *testing.T) {
+	path := writeConfigFile(t, "db-password", "s3cret\n")
+	useSource(t, MapSource{"DB_PASSWORD_FILE": path, "BROKEN_FILE": filepath.Join(t.TempDir(), "missing")})
+
+	if got := GetEnv("DB_PASSWORD", ""); got != "s3cret" {
+		t.Errorf("GetEnv() = %q, want s3cret", got)
+	}
+	if got := GetEnv("BROKEN", "fallback"); got != "fallback" {
+		t.Errorf("GetEnv() = %q, want fallback for unreadable file", got)
+	}
+
+	var cfg struct {
+		Password Secret `env:"DB_PASSWORD"`
+		Broken   string `env:"BROKEN"`
+	}
+	err := LoadEnv(&cfg)
+	if cfg.Password.Value() != "s3cret" {
+		t.Errorf("LoadEnv() Password = %q, want s3cret", cfg.Password.Value())
+	}
+	if err == nil || !strings.Contains(err.Error(), "BROKEN") {
+		t.Errorf("LoadEnv() error = %v, want BROKEN reported", err)
+	}
+
+	env := NewEnv()
+	if got := env.String("DB_PASSWORD", ""); got != "s3cret" {
+		t.Errorf("Env.String() = %q, want s3cret", got)
+	}
+	if strings.Contains(env.Report(), "s3cret") {
+		t.Errorf("Report() leaks a file secret:\n%s", env.Report())
+	}
+}
+
+func TestSecret_References(t *testing.T) {
+	useSource(t, MapSource{
+		"DB_PASSWORD":    "secret://mysql/password",
+		"KAFKA_PASSWORD": "secret://kafka",
+		"PLAIN":          "value",
+	})
+
+	t.Run("No resolver", func(t *testing.T) {
+		var cfg struct {
+			Password string `env:"DB_PASSWORD"`
+		}
+		if err := LoadEnv(&cfg); !errors.Is(err, ErrNoSecretResolver) {
+			t.Errorf("LoadEnv() error = %v, want ErrNoSecretResolver", err)
+		}
+		if got := GetEnv("DB_PASSWORD", "fallback"); got != "fallback" {
+			t.Errorf("GetEnv() = %q, want fallback", got)
+		}
+	})
+
+	t.Run("Resolver", func(t *testing.T) {
+		useSecretResolver(t, SecretResolverFunc(func(ref string) (string, error) {
+			if ref == "mysql/password" {
+				return "from-vault", nil
+			}
+			return "", errors.New("not found")
+		}))
+
+		env := NewEnv()
+		if got := env.Secret("DB_PASSWORD"); got.Value() != "from-vault" {
+			t.Errorf("Env.Secret() = %q, want from-vault", got.Value())
+		}
+		env.Secret("KAFKA_PASSWORD")
+		if got := env.String("PLAIN", ""); got != "value" {
+			t.Errorf("Env.String() = %q, want value", got)
+		}
+
+		if err := env.Err(); err == nil || !strings.Contains(err.Error(), "KAFKA_PASSWORD") {
+			t.Errorf("Err() = %v, want KAFKA_PASSWORD reported", err)
+		}
+		if strings.Contains(env.Report(), "from-vault") {
+			t.Errorf("Report() leaks a resolved secret:\n%s", env.Report())
+		}
+	})
+}
+
+func TestDirSecretResolver(t *testing.T) {
+	dir := filepath.Dir(writeConfigFile(t, "api-key", "abc123\n"))
+	r := DirSecretResolver(dir)
+
+	if got, err := r.ResolveSecret("api-key"); err != nil || got != "abc123" {
+		t.Errorf("ResolveSecret() = %q, %v, want abc123", got, err)
+	}
+	if _, err := r.ResolveSecret("../etc/passwd"); err == nil {
+		t.Error("ResolveSecret() should reject references outside the directory")
+	}
+	if _, err := r.ResolveSecret("missing"); err == nil {
+		t.Error("ResolveSecret() expected an error for a missing file")
+	}
+}
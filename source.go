@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source resolves configuration keys.
+type Source interface {
+	Lookup(key string) (string, bool)
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func(key string) (string, bool)
+
+func (f SourceFunc) Lookup(key string) (string, bool) {
+	return f(key)
+}
+
+// EnvSource returns a Source backed by the process environment.
+func EnvSource() Source {
+	return SourceFunc(os.LookupEnv)
+}
+
+// MapSource is an in-memory Source, mostly useful in tests.
+type MapSource map[string]string
+
+func (m MapSource) Lookup(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+// Reloadable is implemented by sources whose contents can change at runtime,
+// such as files. Watcher calls Reload before every poll.
+type Reloadable interface {
+	Reload() error
+}
+
+// Layered combines sources by precedence: the first source that has a key
+// wins. A typical setup lets the environment override mounted files, which
+// override a local .env file:
+//
+//	utils.Layered(utils.EnvSource(), yamlSource, dotenvSource)
+func Layered(sources ...Source) Source {
+	return layeredSource(sources)
+}
+
+type layeredSource []Source
+
+func (l layeredSource) Lookup(key string) (string, bool) {
+	for _, src := range l {
+		if v, ok := src.Lookup(key); ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Reload reloads every layer that is Reloadable.
+func (l layeredSource) Reload() error {
+	var errs []error
+	for _, src := range l {
+		if r, ok := src.(Reloadable); ok {
+			errs = append(errs, r.Reload())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	sourceMu      sync.RWMutex
+	currentSource = EnvSource()
+)
+
+// SetSource replaces the Source used by GetEnv, GetEnvAsInt, GetEnvAsBool,
+// ParseCORSOrigins, LoadEnv and NewEnv. The default is EnvSource.
+func SetSource(src Source) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	currentSource = src
+}
+
+// CurrentSource returns the Source set with SetSource.
+func CurrentSource() Source {
+	sourceMu.RLock()
+	defer sourceMu.RUnlock()
+	return currentSource
+}
+
+// FileSource is a Source read from a configuration file. Keys of nested JSON
+// and YAML documents are flattened to environment style, so
+// {"db": {"max-conns": 10}} is available as DB_MAX_CONNS; lists become
+// comma-separated values.
+type FileSource struct {
+	path  string
+	parse func([]byte) (map[string]string, error)
+
+	mu      sync.RWMutex
+	values  map[string]string
+	modTime time.Time
+	size    int64
+}
+
+// NewDotEnvSource reads KEY=VALUE pairs from a .env file.
+func NewDotEnvSource(path string) (*FileSource, error) {
+	return newFileSource(path, parseDotEnv)
+}
+
+// NewJSONSource reads a JSON object from a file.
+func NewJSONSource(path string) (*FileSource, error) {
+	return newFileSource(path, parseJSONConfig)
+}
+
+// NewYAMLSource reads a YAML mapping from a file.
+func NewYAMLSource(path string) (*FileSource, error) {
+	return newFileSource(path, parseYAMLConfig)
+}
+
+func newFileSource(path string, parse func([]byte) (map[string]string, error)) (*FileSource, error) {
+	s := &FileSource{path: path, parse: parse}
+	if err := s.Load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the file the source was read from.
+func (s *FileSource) Path() string {
+	return s.path
+}
+
+// Load re-reads the file. On error the previously loaded values are kept.
+func (s *FileSource) Load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", s.path, err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", s.path, err)
+	}
+	values, err := s.parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	s.values = values
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	s.mu.Unlock()
+	return nil
+}
+
+// Reload re-reads the file if its modification time or size changed since
+// the last successful load.
+func (s *FileSource) Reload() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", s.path, err)
+	}
+
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime) && info.Size() == s.size
+	s.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	return s.Load()
+}
+
+func (s *FileSource) Lookup(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+func parseDotEnv(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+
+		value, err := parseDotEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+func parseDotEnvValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		end := strings.LastIndex(v, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strconv.Unquote(v[:end+1])
+	case strings.HasPrefix(v, "'"):
+		end := strings.LastIndex(v, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return v[1:end], nil
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
+
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	flattenConfig("", doc, values)
+	return values, nil
+}
+
+func parseYAMLConfig(data []byte) (map[string]string, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	flattenConfig("", doc, values)
+	return values, nil
+}
+
+var configKeyReplacer = strings.NewReplacer("-", "_", ".", "_", " ", "_")
+
+func flattenConfig(prefix string, v any, out map[string]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			key := strings.ToUpper(configKeyReplacer.Replace(k))
+			if prefix != "" {
+				key = prefix + "_" + key
+			}
+			flattenConfig(key, v[k], out)
+		}
+	case []any:
+		parts := make([]string, 0, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				flattenConfig(prefix+"_"+strconv.Itoa(i), item, out)
+			default:
+				parts = append(parts, fmt.Sprint(item))
+			}
+		}
+		if len(parts) > 0 {
+			out[prefix] = strings.Join(parts, ",")
+		}
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
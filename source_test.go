@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func useSource(t *testing.T, src Source) {
+	t.Helper()
+	prev := CurrentSource()
+	SetSource(src)
+	t.Cleanup(func() { SetSource(prev) })
+}
+
+func TestNewDotEnvSource(t *testing.T) {
+	path := writeConfigFile(t, ".env", `
+# comment
+APP_NAME=orders
+export DB_USER = root
+DB_PASSWORD="p@ss \"word\""
+GREETING='hello # world'
+PORT=8080 # inline comment
+EMPTY=
+`)
+
+	src, err := NewDotEnvSource(path)
+	if err != nil {
+		t.Fatalf("NewDotEnvSource() error = %v", err)
+	}
+
+	want := map[string]string{
+		"APP_NAME":    "orders",
+		"DB_USER":     "root",
+		"DB_PASSWORD": `p@ss "word"`,
+		"GREETING":    "hello # world",
+		"PORT":        "8080",
+		"EMPTY":       "",
+	}
+	for key, value := range want {
+		if got, ok := src.Lookup(key); !ok || got != value {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", key, got, ok, value)
+		}
+	}
+}
+
+func TestNewDotEnvSource_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "Missing equals", content: "JUST_A_KEY\n"},
+		{name: "Unterminated quote", content: "KEY=\"value\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, ".env", tt.content)
+			if _, err := NewDotEnvSource(path); err == nil {
+				t.Error("NewDotEnvSource() expected an error")
+			}
+		})
+	}
+
+	if _, err := NewDotEnvSource(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("NewDotEnvSource() expected an error for a missing file")
+	}
+}
+
+func TestNewJSONAndYAMLSource(t *testing.T) {
+	jsonPath := writeConfigFile(t, "config.json", `{
+		"db": {"max-conns": 10, "ssl": {"verify": true}},
+		"cors": {"allowed_origins": ["https://a.com", "https://b.com"]},
+		"log.level": "debug",
+		"timeout": null
+	}`)
+	yamlPath := writeConfigFile(t, "config.yaml", `
+db:
+  max-conns: 10
+  ssl:
+    verify: true
+cors:
+  allowed_origins:
+    - https://a.com
+    - https://b.com
+log.level: debug
+timeout:
+`)
+
+	want := map[string]string{
+		"DB_MAX_CONNS":         "10",
+		"DB_SSL_VERIFY":        "true",
+		"CORS_ALLOWED_ORIGINS": "https://a.com,https://b.com",
+		"LOG_LEVEL":            "debug",
+		"TIMEOUT":              "",
+	}
+
+	jsonSrc, err := NewJSONSource(jsonPath)
+	if err != nil {
+		t.Fatalf("NewJSONSource() error = %v", err)
+	}
+	yamlSrc, err := NewYAMLSource(yamlPath)
+	if err != nil {
+		t.Fatalf("NewYAMLSource() error = %v", err)
+	}
+
+	for _, src := range []*FileSource{jsonSrc, yamlSrc} {
+		for key, value := range want {
+			if got, ok := src.Lookup(key); !ok || got != value {
+				t.Errorf("%s: Lookup(%q) = %q, %v, want %q", filepath.Base(src.Path()), key, got, ok, value)
+			}
+		}
+	}
+}
+
+func TestFileSource_LoadKeepsValuesOnError(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"name": "orders"}`)
+	src, err := NewJSONSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("{broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Load(); err == nil {
+		t.Error("Load() expected an error")
+	}
+	if got, _ := src.Lookup("NAME"); got != "orders" {
+		t.Errorf("Lookup() = %q, want previous value", got)
+	}
+}
+
+func TestLayered(t *testing.T) {
+	src := Layered(
+		MapSource{"A": "high"},
+		MapSource{"A": "low", "B": "low"},
+	)
+
+	if got, _ := src.Lookup("A"); got != "high" {
+		t.Errorf("Lookup(A) = %q, want high", got)
+	}
+	if got, _ := src.Lookup("B"); got != "low" {
+		t.Errorf("Lookup(B) = %q, want low", got)
+	}
+	if _, ok := src.Lookup("C"); ok {
+		t.Error("Lookup(C) should not be found")
+	}
+}
+
+func TestSetSource(t *testing.T) {
+	t.Setenv("TEST_SOURCE_PORT", "9000")
+	useSource(t, Layered(EnvSource(), MapSource{
+		"TEST_SOURCE_PORT":     "8000",
+		"TEST_SOURCE_DEBUG":    "true",
+		"CORS_ALLOWED_ORIGINS": "https://a.com, https://b.com",
+	}))
+
+	if got := GetEnvAsInt("TEST_SOURCE_PORT", 0); got != 9000 {
+		t.Errorf("GetEnvAsInt() = %v, want env to take precedence", got)
+	}
+	if got := GetEnvAsBool("TEST_SOURCE_DEBUG", false); !got {
+		t.Errorf("GetEnvAsBool() = %v, want true", got)
+	}
+	if got := ParseCORSOrigins(); !reflect.DeepEqual(got, []string{"https://a.com", "https://b.com"}) {
+		t.Errorf("ParseCORSOrigins() = %v", got)
+	}
+
+	var cfg struct {
+		Debug bool `env:"TEST_SOURCE_DEBUG"`
+	}
+	if err := LoadEnv(&cfg); err != nil || !cfg.Debug {
+		t.Errorf("LoadEnv() = %+v, %v", cfg, err)
+	}
+	if got := NewEnvFrom(MapSource{"X": "1"}).MustInt("X"); got != 1 {
+		t.Errorf("NewEnvFrom().MustInt() = %v, want 1", got)
+	}
+}
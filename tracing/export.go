@@ -0,0 +1,236 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrProcessorShutdown is returned by a BatchProcessor after Shutdown.
+var ErrProcessorShutdown = errors.New("span processor is shut down")
+
+// Exporter sends ended spans to a backend.
+type Exporter interface {
+	// ExportSpans exports a batch. It is never called concurrently by
+	// BatchProcessor, and must not retain the slice.
+	ExportSpans(ctx context.Context, spans []*Span) error
+	// Shutdown flushes and releases the exporter.
+	Shutdown(ctx context.Context) error
+}
+
+// BatchConfig configures a BatchProcessor. Zero values get defaults.
+type BatchConfig struct {
+	// MaxQueueSize bounds the spans waiting for export; spans ending while
+	// the queue is full are dropped. Defaults to 2048.
+	MaxQueueSize int
+	// MaxBatchSize bounds the spans per export. Defaults to 512.
+	MaxBatchSize int
+	// FlushInterval is the longest a span waits for export. Defaults to 5s.
+	FlushInterval time.Duration
+	// ExportTimeout bounds each export. Defaults to 30s.
+	ExportTimeout time.Duration
+	// OnError, if set, is called with export errors.
+	OnError func(error)
+}
+
+// BatchStats counts what happened to the spans handed to a BatchProcessor.
+type BatchStats struct {
+	Exported uint64
+	// Dropped spans ended while the queue was full or after Shutdown.
+	Dropped uint64
+	// Failed spans were part of a batch the exporter rejected.
+	Failed uint64
+}
+
+// BatchProcessor is a SpanProcessor that queues ended spans and exports them
+// in batches from a background goroutine:
+//
+//	bp := tracing.NewBatchProcessor(tracing.NewStdoutExporter(), tracing.BatchConfig{})
+//	tracing.SetSpanProcessor(bp)
+//	defer bp.Shutdown(context.Background())
+type BatchProcessor struct {
+	exporter Exporter
+	cfg      BatchConfig
+
+	queue chan *Span
+	flush chan flushRequest
+	// stop is closed by Shutdown after setting stopCtx; run stores the
+	// result of the final export in stopErr before closing done.
+	stop    chan struct{}
+	stopCtx context.Context
+	stopErr error
+	done    chan struct{}
+
+	shutdownOnce sync.Once
+	shutdown     atomic.Bool
+
+	exported atomic.Uint64
+	dropped  atomic.Uint64
+	failed   atomic.Uint64
+}
+
+// NewBatchProcessor starts a BatchProcessor exporting to exp.
+func NewBatchProcessor(exp Exporter, cfg BatchConfig) *BatchProcessor {
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = 2048
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = 512
+	}
+	if cfg.MaxBatchSize > cfg.MaxQueueSize {
+		cfg.MaxBatchSize = cfg.MaxQueueSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.ExportTimeout <= 0 {
+		cfg.ExportTimeout = 30 * time.Second
+	}
+
+	p := &BatchProcessor{
+		exporter: exp,
+		cfg:      cfg,
+		queue:    make(chan *Span, cfg.MaxQueueSize),
+		flush:    make(chan flushRequest),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *BatchProcessor) OnStart(*Span) {}
+
+// OnEnd queues span without blocking.
+func (p *BatchProcessor) OnEnd(span *Span) {
+	if p.shutdown.Load() {
+		p.dropped.Add(1)
+		return
+	}
+	select {
+	case p.queue <- span:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Stats returns the counters of the processor.
+func (p *BatchProcessor) Stats() BatchStats {
+	return BatchStats{Exported: p.exported.Load(), Dropped: p.dropped.Load(), Failed: p.failed.Load()}
+}
+
+// ForceFlush exports every queued span and returns the export errors.
+// Exports are bounded by ctx as well as ExportTimeout.
+func (p *BatchProcessor) ForceFlush(ctx context.Context) error {
+	if p.shutdown.Load() {
+		return ErrProcessorShutdown
+	}
+	req := flushRequest{ctx: ctx, reply: make(chan error, 1)}
+	select {
+	case p.flush <- req:
+	case <-p.done:
+		return ErrProcessorShutdown
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops accepting spans, exports the queued ones and shuts the
+// exporter down once the last export has returned. Exports are bounded by
+// ctx; if it expires first, Shutdown returns its error and the exporter is
+// shut down in the background. Later calls return ErrProcessorShutdown.
+func (p *BatchProcessor) Shutdown(ctx context.Context) error {
+	err := ErrProcessorShutdown
+	p.shutdownOnce.Do(func() {
+		p.shutdown.Store(true)
+		p.stopCtx = ctx
+		close(p.stop)
+		select {
+		case <-p.done:
+			err = errors.Join(p.stopErr, p.exporter.Shutdown(ctx))
+		case <-ctx.Done():
+			err = ctx.Err()
+			go func() {
+				<-p.done
+				_ = p.exporter.Shutdown(context.Background())
+			}()
+		}
+	})
+	return err
+}
+
+type flushRequest struct {
+	ctx   context.Context
+	reply chan error
+}
+
+func (p *BatchProcessor) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, p.cfg.MaxBatchSize)
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) >= p.cfg.MaxBatchSize {
+				p.export(context.Background(), batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			p.export(context.Background(), batch)
+			batch = batch[:0]
+		case req := <-p.flush:
+			req.reply <- p.drain(req.ctx, batch)
+			batch = batch[:0]
+		case <-p.stop:
+			p.stopErr = p.drain(p.stopCtx, batch)
+			return
+		}
+	}
+}
+
+// drain exports batch and everything queued behind it.
+func (p *BatchProcessor) drain(ctx context.Context, batch []*Span) error {
+	var errs []error
+	for {
+		select {
+		case span := <-p.queue:
+			batch = append(batch, span)
+			if len(batch) < p.cfg.MaxBatchSize {
+				continue
+			}
+		default:
+			errs = append(errs, p.export(ctx, batch))
+			return errors.Join(errs...)
+		}
+		errs = append(errs, p.export(ctx, batch))
+		batch = batch[:0]
+	}
+}
+
+func (p *BatchProcessor) export(ctx context.Context, batch []*Span) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ExportTimeout)
+	defer cancel()
+	if err := p.exporter.ExportSpans(ctx, batch); err != nil {
+		p.failed.Add(uint64(len(batch)))
+		if p.cfg.OnError != nil {
+			p.cfg.OnError(err)
+		}
+		return err
+	}
+	p.exported.Add(uint64(len(batch)))
+	return nil
+}
@@ -0,0 +1,275 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func endedSpan(name string) *Span {
+	_, span := StartSpan(context.Background(), name)
+	span.End()
+	return span
+}
+
+// gatedExporter blocks each export until released.
+type gatedExporter struct {
+	*Recorder
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (e *gatedExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	e.entered <- struct{}{}
+	<-e.release
+	return e.Recorder.ExportSpans(ctx, spans)
+}
+
+type failingExporter struct{ Recorder }
+
+func (*failingExporter) ExportSpans(context.Context, []*Span) error {
+	return errors.New("collector down")
+}
+
+func TestBatchProcessor_ExportsInBatches(t *testing.T) {
+	rec := NewRecorder()
+	bp := NewBatchProcessor(rec, BatchConfig{MaxBatchSize: 2, FlushInterval: time.Hour})
+
+	for _, name := range []string{"a", "b", "c"} {
+		bp.OnEnd(endedSpan(name))
+	}
+	require.Eventually(t, func() bool { return len(rec.Exported()) == 2 }, time.Second, time.Millisecond,
+		"a full batch is exported without waiting for the interval")
+
+	require.NoError(t, bp.ForceFlush(context.Background()))
+	assert.Len(t, rec.Exported(), 3)
+	assert.Equal(t, BatchStats{Exported: 3}, bp.Stats())
+}
+
+func TestBatchProcessor_FlushInterval(t *testing.T) {
+	rec := NewRecorder()
+	bp := NewBatchProcessor(rec, BatchConfig{FlushInterval: 10 * time.Millisecond})
+	defer bp.Shutdown(context.Background())
+
+	bp.OnEnd(endedSpan("a"))
+	assert.Eventually(t, func() bool { return rec.Find("a") != nil }, time.Second, time.Millisecond)
+}
+
+func TestBatchProcessor_DropsWhenQueueFull(t *testing.T) {
+	exp := &gatedExporter{Recorder: NewRecorder(), entered: make(chan struct{}), release: make(chan struct{})}
+	bp := NewBatchProcessor(exp, BatchConfig{MaxQueueSize: 2, MaxBatchSize: 1, FlushInterval: time.Hour})
+
+	bp.OnEnd(endedSpan("in-flight"))
+	<-exp.entered
+	bp.OnEnd(endedSpan("queued-1"))
+	bp.OnEnd(endedSpan("queued-2"))
+	bp.OnEnd(endedSpan("dropped"))
+	assert.Equal(t, uint64(1), bp.Stats().Dropped)
+
+	go func() {
+		for range exp.entered {
+		}
+	}()
+	close(exp.release)
+	require.NoError(t, bp.Shutdown(context.Background()))
+	close(exp.entered)
+
+	assert.Equal(t, BatchStats{Exported: 3, Dropped: 1}, bp.Stats())
+	assert.Nil(t, exp.Find("dropped"))
+}
+
+func TestBatchProcessor_Shutdown(t *testing.T) {
+	rec := NewRecorder()
+	bp := NewBatchProcessor(rec, BatchConfig{FlushInterval: time.Hour})
+
+	bp.OnEnd(endedSpan("a"))
+	require.NoError(t, bp.Shutdown(context.Background()))
+	assert.NotNil(t, rec.Find("a"), "queued spans are exported on shutdown")
+
+	bp.OnEnd(endedSpan("late"))
+	assert.Equal(t, uint64(1), bp.Stats().Dropped)
+	assert.ErrorIs(t, bp.Shutdown(context.Background()), ErrProcessorShutdown)
+	assert.ErrorIs(t, bp.ForceFlush(context.Background()), ErrProcessorShutdown)
+}
+
+// blockingExporter blocks each export until its context is done, and notes
+// whether Shutdown overlapped an export.
+type blockingExporter struct {
+	exporting   atomic.Bool
+	overlapped  atomic.Bool
+	shutdown    chan struct{}
+	exportedErr error
+}
+
+func (e *blockingExporter) ExportSpans(ctx context.Context, _ []*Span) error {
+	e.exporting.Store(true)
+	defer e.exporting.Store(false)
+	<-ctx.Done()
+	e.exportedErr = ctx.Err()
+	return ctx.Err()
+}
+
+func (e *blockingExporter) Shutdown(context.Context) error {
+	e.overlapped.Store(e.exporting.Load())
+	close(e.shutdown)
+	return nil
+}
+
+func TestBatchProcessor_ShutdownDeadline(t *testing.T) {
+	exp := &blockingExporter{shutdown: make(chan struct{})}
+	bp := NewBatchProcessor(exp, BatchConfig{FlushInterval: time.Hour})
+	bp.OnEnd(endedSpan("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := bp.Shutdown(ctx)
+	assert.Less(t, time.Since(start), time.Second, "the export honours the Shutdown deadline")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	select {
+	case <-exp.shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("exporter was not shut down")
+	}
+	assert.False(t, exp.overlapped.Load(), "the exporter is shut down after the last export returned")
+	assert.ErrorIs(t, exp.exportedErr, context.DeadlineExceeded)
+	assert.Equal(t, uint64(1), bp.Stats().Failed)
+}
+
+func TestBatchProcessor_ForceFlushDeadline(t *testing.T) {
+	exp := &blockingExporter{shutdown: make(chan struct{})}
+	bp := NewBatchProcessor(exp, BatchConfig{FlushInterval: time.Hour})
+	bp.OnEnd(endedSpan("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, bp.ForceFlush(ctx), context.DeadlineExceeded)
+	require.NoError(t, bp.Shutdown(context.Background()))
+}
+
+func TestRecorder_ProcessorAndExporter(t *testing.T) {
+	rec := NewRecorder()
+	span := endedSpan("a")
+	rec.OnEnd(span)
+	require.NoError(t, rec.ExportSpans(context.Background(), []*Span{span}))
+
+	assert.Equal(t, []*Span{span}, rec.Ended())
+	assert.Equal(t, []*Span{span}, rec.Exported())
+	assert.Same(t, span, rec.Find("a"))
+	rec.Reset()
+	assert.Empty(t, rec.Exported())
+}
+
+func TestBatchProcessor_ExportErrors(t *testing.T) {
+	var reported []error
+	bp := NewBatchProcessor(&failingExporter{}, BatchConfig{FlushInterval: time.Hour, OnError: func(err error) {
+		reported = append(reported, err)
+	}})
+
+	bp.OnEnd(endedSpan("a"))
+	bp.OnEnd(endedSpan("b"))
+	assert.EqualError(t, bp.ForceFlush(context.Background()), "collector down")
+	require.NoError(t, bp.Shutdown(context.Background()))
+
+	assert.Equal(t, BatchStats{Failed: 2}, bp.Stats())
+	assert.Len(t, reported, 1)
+}
+
+func TestJSONExporter(t *testing.T) {
+	_, span := StartSpan(context.Background(), "op", WithSpanKind(SpanKindClient), WithAttributes(map[string]any{"k": "v"}))
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	var buf bytes.Buffer
+	exp := NewJSONExporter(&buf)
+	require.NoError(t, exp.ExportSpans(context.Background(), []*Span{span, endedSpan("second")}))
+
+	lines := bufio.NewScanner(&buf)
+	require.True(t, lines.Scan())
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(lines.Bytes(), &got))
+	assert.Equal(t, span.Context().TraceID, got["trace_id"])
+	assert.Equal(t, span.Context().SpanID, got["span_id"])
+	assert.Equal(t, "op", got["name"])
+	assert.Equal(t, "client", got["kind"])
+	assert.Equal(t, "error", got["status"])
+	assert.Equal(t, "boom", got["status_message"])
+	assert.Equal(t, map[string]any{"k": "v"}, got["attributes"])
+	assert.Len(t, got["events"], 1)
+	require.True(t, lines.Scan(), "one line per span")
+	assert.False(t, lines.Scan())
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var received otlpRequest
+	var header http.Header
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		header = r.Header
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	ctx, parent := StartSpan(context.Background(), "parent", WithSpanKind(SpanKindServer))
+	_, child := StartSpan(ctx, "child", WithAttributes(map[string]any{"rows": 3, "ok": true, "tags": []string{"a"}}))
+	child.SetStatus(StatusError, "failed")
+	child.End()
+	parent.End()
+
+	exp := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL + "/", ServiceName: "orders", Headers: map[string]string{"Authorization": "Bearer t"}})
+	require.NoError(t, exp.ExportSpans(context.Background(), []*Span{child, parent}))
+
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer t", header.Get("Authorization"))
+	require.Len(t, received.ResourceSpans, 1)
+	rs := received.ResourceSpans[0]
+	assert.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+	assert.Equal(t, "orders", *rs.Resource.Attributes[0].Value.StringValue)
+	require.Len(t, rs.ScopeSpans, 1)
+	spans := rs.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+
+	got := spans[0]
+	assert.Equal(t, child.Context().TraceID, got.TraceID)
+	assert.Equal(t, child.Context().SpanID, got.SpanID)
+	assert.Equal(t, parent.Context().SpanID, got.ParentSpanID)
+	assert.Equal(t, 1, got.Kind, "internal")
+	assert.Equal(t, 2, spans[1].Kind, "server")
+	assert.Equal(t, 2, got.Status.Code, "error")
+	assert.Equal(t, "failed", got.Status.Message)
+	assert.Equal(t, unixNano(child.StartTime()), got.StartTimeUnixNano)
+
+	attrs := map[string]otlpAnyValue{}
+	for _, kv := range got.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "3", *attrs["rows"].IntValue)
+	assert.True(t, *attrs["ok"].BoolValue)
+	assert.Equal(t, "a", *attrs["tags"].ArrayValue.Values[0].StringValue)
+}
+
+func TestOTLPExporter_CollectorError(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer collector.Close()
+
+	err := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL}).ExportSpans(context.Background(), []*Span{endedSpan("a")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "429")
+	assert.Contains(t, err.Error(), "quota exceeded")
+}
@@ -0,0 +1,174 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// otelScope is the instrumentation scope of spans bridged to OpenTelemetry.
+const otelScope = "github.com/salahfarzin/utils/tracing"
+
+var (
+	tracerMu sync.RWMutex
+	tracer   oteltrace.Tracer
+)
+
+// SetTracerProvider bridges spans to OpenTelemetry: from then on StartSpan
+// also starts an OTel span from tp, continuing the OTel span in ctx or the
+// TraceContext of this package, and the Span adopts its IDs and sampling
+// decision. SpanProcessors still receive sampled spans. A nil tp disables the
+// bridge.
+func SetTracerProvider(tp oteltrace.TracerProvider) {
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	if tp == nil {
+		tracer = nil
+		return
+	}
+	tracer = tp.Tracer(otelScope)
+}
+
+func currentTracer() oteltrace.Tracer {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	return tracer
+}
+
+// OTelSpanContext converts tc to an OTel span context. It is invalid if tc is.
+func OTelSpanContext(tc TraceContext) oteltrace.SpanContext {
+	traceID, _ := oteltrace.TraceIDFromHex(tc.TraceID)
+	spanID, _ := oteltrace.SpanIDFromHex(tc.SpanID)
+	state, _ := oteltrace.ParseTraceState(tc.State)
+	return oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: oteltrace.TraceFlags(tc.Flags),
+		TraceState: state,
+	})
+}
+
+// TraceContextFromOTel converts an OTel span context to a TraceContext.
+func TraceContextFromOTel(sc oteltrace.SpanContext) TraceContext {
+	return TraceContext{
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+		Flags:   byte(sc.TraceFlags()),
+		State:   sc.TraceState().String(),
+	}
+}
+
+// startOTelSpan starts the OTel counterpart of a span that would otherwise
+// use tc. The parent is the OTel span in ctx, else the caller of tc. It
+// returns ok=false if the tracer produced no valid span, e.g. a no-op
+// provider.
+func startOTelSpan(ctx context.Context, tr oteltrace.Tracer, name string, cfg spanConfig, tc TraceContext) (context.Context, oteltrace.Span, TraceContext, bool) {
+	parent := oteltrace.SpanContextFromContext(ctx)
+	if !parent.IsValid() {
+		remote := TraceContext{TraceID: tc.TraceID, SpanID: tc.ParentSpanID, Flags: tc.Flags, State: tc.State}
+		if sc := OTelSpanContext(remote); sc.IsValid() {
+			parent = sc.WithRemote(true)
+			ctx = oteltrace.ContextWithRemoteSpanContext(ctx, parent)
+		} else {
+			// A root span: let OTelIDGenerator keep the trace ID.
+			ctx = InjectTraceIDToContext(ctx, tc.TraceID)
+		}
+	}
+
+	ctx, span := tr.Start(ctx, name, oteltrace.WithSpanKind(otelSpanKind(cfg.kind)), oteltrace.WithAttributes(otelAttributes(cfg.attrs)...))
+
+	sc := span.SpanContext()
+	if !sc.IsValid() || sc.SpanID() == parent.SpanID() {
+		return ctx, span, tc, false
+	}
+	bridged := TraceContextFromOTel(sc)
+	if parent.IsValid() {
+		bridged.ParentSpanID = parent.SpanID().String()
+	}
+	return ctx, span, bridged, true
+}
+
+func otelSpanKind(k SpanKind) oteltrace.SpanKind {
+	switch k {
+	case SpanKindServer:
+		return oteltrace.SpanKindServer
+	case SpanKindClient:
+		return oteltrace.SpanKindClient
+	case SpanKindProducer:
+		return oteltrace.SpanKindProducer
+	case SpanKindConsumer:
+		return oteltrace.SpanKindConsumer
+	}
+	return oteltrace.SpanKindInternal
+}
+
+func otelStatusCode(s SpanStatus) codes.Code {
+	switch s {
+	case StatusOK:
+		return codes.Ok
+	case StatusError:
+		return codes.Error
+	}
+	return codes.Unset
+}
+
+// otelAttribute converts an attribute value; unknown types are formatted
+// with fmt.Sprint.
+func otelAttribute(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int32:
+		return attribute.Int64(key, int64(v))
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	case time.Duration:
+		return attribute.String(key, v.String())
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
+
+func otelAttributes(attrs map[string]any) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, otelAttribute(k, v))
+	}
+	return kvs
+}
+
+// OTelIDGenerator is an IDGenerator for the OTel SDK
+// (sdktrace.WithIDGenerator) that starts root spans in the trace named by
+// GetTraceIDFromContext, so trace IDs set with InjectTraceIDToContext or
+// received from callers are kept by OTel. IDs that are not 32 hex digits
+// (or UUIDs) are replaced by random ones.
+type OTelIDGenerator struct{}
+
+func (OTelIDGenerator) NewIDs(ctx context.Context) (oteltrace.TraceID, oteltrace.SpanID) {
+	traceID, err := oteltrace.TraceIDFromHex(normalizeTraceID(GetTraceIDFromContext(ctx)))
+	if err != nil {
+		traceID, _ = oteltrace.TraceIDFromHex(NewTraceID())
+	}
+	return traceID, newOTelSpanID()
+}
+
+func (OTelIDGenerator) NewSpanID(context.Context, oteltrace.TraceID) oteltrace.SpanID {
+	return newOTelSpanID()
+}
+
+func newOTelSpanID() oteltrace.SpanID {
+	id, _ := oteltrace.SpanIDFromHex(NewSpanID())
+	return id
+}
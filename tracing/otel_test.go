@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp), sdktrace.WithIDGenerator(OTelIDGenerator{}))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return tp, exp
+}
+
+func bridgeToOTel(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	tp, exp := newTestTracerProvider(t)
+	SetTracerProvider(tp)
+	t.Cleanup(func() { SetTracerProvider(nil) })
+	return exp
+}
+
+func TestGetTraceIDFromContext_OTelSpan(t *testing.T) {
+	tp, _ := newTestTracerProvider(t)
+
+	ctx := InjectTraceIDToContext(context.Background(), "legacy-id")
+	assert.Equal(t, "legacy-id", GetTraceIDFromContext(ctx))
+
+	ctx, span := tp.Tracer("test").Start(ctx, "op")
+	defer span.End()
+	assert.Equal(t, span.SpanContext().TraceID().String(), GetTraceIDFromContext(ctx))
+
+	tc, ok := TraceContextFromContext(ctx)
+	require.True(t, ok, "OTel spans are visible as a TraceContext")
+	assert.Equal(t, span.SpanContext().SpanID().String(), tc.SpanID)
+}
+
+func TestOTelIDGenerator_KeepsInjectedTraceID(t *testing.T) {
+	tp, exp := newTestTracerProvider(t)
+
+	ctx := InjectTraceIDToContext(context.Background(), testTraceID)
+	_, span := tp.Tracer("test").Start(ctx, "op")
+	span.End()
+
+	require.Len(t, exp.GetSpans(), 1)
+	assert.Equal(t, testTraceID, exp.GetSpans()[0].SpanContext.TraceID().String())
+}
+
+func TestSetTracerProvider_BridgesSpans(t *testing.T) {
+	exp := bridgeToOTel(t)
+
+	ctx, root := StartSpan(InjectTraceIDToContext(context.Background(), testTraceID), "root",
+		WithSpanKind(SpanKindServer), WithAttributes(map[string]any{"http.method": "GET"}))
+	childCtx, child := StartSpan(ctx, "child")
+	child.SetAttribute("rows", 3)
+	child.RecordError(errors.New("boom"))
+	child.End()
+	root.End()
+
+	assert.Equal(t, oteltrace.SpanContextFromContext(childCtx).SpanID().String(), child.Context().SpanID)
+	assert.Equal(t, root.Context().SpanID, child.Context().ParentSpanID)
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 2)
+	otelChild, otelRoot := spans[0], spans[1]
+
+	assert.Equal(t, testTraceID, otelRoot.SpanContext.TraceID().String())
+	assert.Equal(t, root.Context().SpanID, otelRoot.SpanContext.SpanID().String())
+	assert.Equal(t, oteltrace.SpanKindServer, otelRoot.SpanKind)
+	assert.Contains(t, otelRoot.Attributes, attribute.String("http.method", "GET"))
+	assert.Equal(t, root.EndTime(), otelRoot.EndTime)
+
+	assert.Equal(t, otelRoot.SpanContext.SpanID(), otelChild.Parent.SpanID())
+	assert.Contains(t, otelChild.Attributes, attribute.Int("rows", 3))
+	assert.Equal(t, codes.Error, otelChild.Status.Code)
+	assert.Equal(t, "boom", otelChild.Status.Description)
+	require.Len(t, otelChild.Events, 1)
+	assert.Equal(t, "exception", otelChild.Events[0].Name)
+}
+
+func TestSetTracerProvider_RemoteParent(t *testing.T) {
+	exp := bridgeToOTel(t)
+
+	parent, err := ParseTraceparent(testTraceparent)
+	require.NoError(t, err)
+	parent.State = "vendor=1"
+
+	_, span := StartSpan(context.Background(), "server", WithTraceContext(parent.Child()))
+	span.End()
+
+	assert.Equal(t, testSpanID, span.Context().ParentSpanID)
+	assert.Equal(t, "vendor=1", span.Context().State)
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, testTraceID, spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, testSpanID, spans[0].Parent.SpanID().String())
+	assert.True(t, spans[0].Parent.IsRemote())
+}
+
+func TestStartSpan_ContinuesForeignOTelSpan(t *testing.T) {
+	tp, _ := newTestTracerProvider(t)
+
+	ctx, otelSpan := tp.Tracer("otelhttp").Start(context.Background(), "outer")
+	defer otelSpan.End()
+
+	_, span := StartSpan(ctx, "inner")
+	assert.Equal(t, otelSpan.SpanContext().TraceID().String(), span.Context().TraceID)
+	assert.Equal(t, otelSpan.SpanContext().SpanID().String(), span.Context().ParentSpanID)
+}
@@ -0,0 +1,242 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPConfig configures an OTLPExporter. It can be filled from the
+// environment with utils.LoadEnv.
+type OTLPConfig struct {
+	// Endpoint is the collector base URL, e.g. http://otel-collector:4318;
+	// spans are posted to Endpoint + "/v1/traces".
+	Endpoint string `env:"OTEL_EXPORTER_OTLP_ENDPOINT" required:"true"`
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string `env:"OTEL_SERVICE_NAME"`
+	// Headers are added to every request, e.g. for collector authentication.
+	Headers map[string]string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP over
+// HTTP with JSON encoding.
+type OTLPExporter struct {
+	url     string
+	service string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewOTLPExporter creates an OTLPExporter.
+func NewOTLPExporter(cfg OTLPConfig) *OTLPExporter {
+	client := cfg.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &OTLPExporter{
+		url:     strings.TrimSuffix(cfg.Endpoint, "/") + "/v1/traces",
+		service: cfg.ServiceName,
+		headers: cfg.Headers,
+		client:  client,
+	}
+}
+
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlp export: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("otlp export: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(context.Context) error { return nil }
+
+// The types below follow the JSON mapping of the OTLP trace protobufs.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Flags             uint32         `json:"flags,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+func (e *OTLPExporter) request(spans []*Span) otlpRequest {
+	var resource otlpResource
+	if e.service != "" {
+		resource.Attributes = []otlpKeyValue{{Key: "service.name", Value: otlpValue(e.service)}}
+	}
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		out = append(out, otlpSpanOf(s))
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   resource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: otelScope}, Spans: out}},
+	}}}
+}
+
+func otlpSpanOf(s *Span) otlpSpan {
+	tc := s.Context()
+	status, msg := s.Status()
+	out := otlpSpan{
+		TraceID:           tc.TraceID,
+		SpanID:            tc.SpanID,
+		ParentSpanID:      tc.ParentSpanID,
+		TraceState:        tc.State,
+		Flags:             uint32(tc.Flags),
+		Name:              s.Name(),
+		Kind:              int(otelSpanKind(s.Kind())), // the OTel API numbers kinds like OTLP
+		StartTimeUnixNano: unixNano(s.StartTime()),
+		EndTimeUnixNano:   unixNano(s.EndTime()),
+		Attributes:        otlpAttributes(s.Attributes()),
+		Status:            otlpStatus{Code: otlpStatusCode(status), Message: msg},
+	}
+	for _, ev := range s.Events() {
+		out.Events = append(out.Events, otlpEvent{TimeUnixNano: unixNano(ev.Time), Name: ev.Name, Attributes: otlpAttributes(ev.Attributes)})
+	}
+	return out
+}
+
+// otlpStatusCode maps a status to the OTLP enum, which numbers OK and ERROR
+// differently from the codes package of the OTel API.
+func otlpStatusCode(s SpanStatus) int {
+	switch s {
+	case StatusOK:
+		return 1
+	case StatusError:
+		return 2
+	}
+	return 0
+}
+
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpValue(v)})
+	}
+	return kvs
+}
+
+// otlpValue converts an attribute value like otelAttribute does.
+func otlpValue(value any) otlpAnyValue {
+	switch v := value.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		return otlpInt(int64(v))
+	case int32:
+		return otlpInt(int64(v))
+	case int64:
+		return otlpInt(v)
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	case []string:
+		values := make([]otlpAnyValue, len(v))
+		for i, s := range v {
+			values[i] = otlpValue(s)
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	}
+	s := otelAttribute("", value).Value.Emit()
+	return otlpAnyValue{StringValue: &s}
+}
+
+// otlpInt encodes 64-bit integers as strings, as the JSON mapping requires.
+func otlpInt(i int64) otlpAnyValue {
+	s := strconv.FormatInt(i, 10)
+	return otlpAnyValue{IntValue: &s}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
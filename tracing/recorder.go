@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Recorder keeps spans in memory for assertions in tests. It is both a
+// SpanProcessor and an Exporter; spans it ends and spans it exports are kept
+// apart, so one Recorder can play both roles without counting spans twice:
+//
+//	rec := tracing.NewRecorder()
+//	tracing.SetSpanProcessor(rec)
+//	t.Cleanup(func() { tracing.SetSpanProcessor(nil) })
+type Recorder struct {
+	mu       sync.Mutex
+	started  []*Span
+	ended    []*Span
+	exported []*Span
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) OnStart(span *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, span)
+}
+
+func (r *Recorder) OnEnd(span *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ended = append(r.ended, span)
+}
+
+func (r *Recorder) ExportSpans(_ context.Context, spans []*Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exported = append(r.exported, spans...)
+	return nil
+}
+
+func (r *Recorder) Shutdown(context.Context) error { return nil }
+
+// Started returns the spans started so far, in order.
+func (r *Recorder) Started() []*Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.started)
+}
+
+// Ended returns the spans ended so far, in order.
+func (r *Recorder) Ended() []*Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.ended)
+}
+
+// Exported returns the spans exported so far, in order.
+func (r *Recorder) Exported() []*Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.exported)
+}
+
+// Find returns the first ended span with the given name, or else the first
+// exported one, or nil.
+func (r *Recorder) Find(name string) *Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, span := range slices.Concat(r.ended, r.exported) {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// Reset forgets all recorded spans.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started, r.ended, r.exported = nil, nil, nil
+}
@@ -0,0 +1,192 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SamplingParams describes a span about to start.
+type SamplingParams struct {
+	TraceID string
+	Name    string
+	Kind    SpanKind
+	// Attributes are those passed with WithAttributes; TracingMiddleware sets
+	// "http.method" and "url.path".
+	Attributes map[string]any
+	// Parent is the parent span, local or remote; it is the zero value for
+	// root spans.
+	Parent TraceContext
+}
+
+// HasParent reports whether the span has a parent.
+func (p SamplingParams) HasParent() bool {
+	return p.Parent.IsValid()
+}
+
+// Sampler decides whether a span is recorded. The decision is stored in the
+// sampled flag of its TraceContext, so it is propagated downstream in the
+// traceparent header, gRPC metadata and Kafka headers.
+type Sampler interface {
+	ShouldSample(p SamplingParams) bool
+}
+
+// SamplerFunc adapts a function to a Sampler.
+type SamplerFunc func(p SamplingParams) bool
+
+func (f SamplerFunc) ShouldSample(p SamplingParams) bool { return f(p) }
+
+// AlwaysSample samples every span.
+func AlwaysSample() Sampler {
+	return SamplerFunc(func(SamplingParams) bool { return true })
+}
+
+// NeverSample samples no span.
+func NeverSample() Sampler {
+	return SamplerFunc(func(SamplingParams) bool { return false })
+}
+
+// TraceIDRatio samples the given fraction of traces. The decision depends
+// only on the trace ID, so every service using the same fraction agrees.
+func TraceIDRatio(fraction float64) Sampler {
+	if fraction >= 1 {
+		return AlwaysSample()
+	}
+	if fraction <= 0 || math.IsNaN(fraction) {
+		return NeverSample()
+	}
+	bound := uint64(fraction * (1 << 63))
+	return SamplerFunc(func(p SamplingParams) bool {
+		if len(p.TraceID) != 32 {
+			return false
+		}
+		b, err := hex.DecodeString(p.TraceID[16:])
+		if err != nil {
+			return false
+		}
+		return binary.BigEndian.Uint64(b)>>1 < bound
+	})
+}
+
+// ParentBased follows the decision of the parent span and asks root for
+// spans without one.
+func ParentBased(root Sampler) Sampler {
+	return SamplerFunc(func(p SamplingParams) bool {
+		if p.HasParent() {
+			return p.Parent.Sampled()
+		}
+		return root.ShouldSample(p)
+	})
+}
+
+// RouteRule selects the sampler for matching requests.
+type RouteRule struct {
+	// Method matches the "http.method" attribute; empty matches any method.
+	Method string
+	// Path matches the "url.path" attribute exactly, or as a prefix if it
+	// ends with "*", e.g. "/static/*".
+	Path    string
+	Sampler Sampler
+}
+
+func (r RouteRule) matches(p SamplingParams) bool {
+	path, ok := p.Attributes["url.path"].(string)
+	if !ok {
+		return false
+	}
+	if r.Method != "" {
+		if method, _ := p.Attributes["http.method"].(string); !strings.EqualFold(method, r.Method) {
+			return false
+		}
+	}
+	if prefix, ok := strings.CutSuffix(r.Path, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == r.Path
+}
+
+// RouteSampler uses the sampler of the first matching rule and fallback for
+// everything else, including spans that are not HTTP requests:
+//
+//	tracing.SetSampler(tracing.ParentBased(tracing.RouteSampler([]tracing.RouteRule{
+//		{Path: "/healthz", Sampler: tracing.NeverSample()},
+//		{Path: "/api/search*", Sampler: tracing.TraceIDRatio(0.01)},
+//	}, tracing.AlwaysSample())))
+func RouteSampler(rules []RouteRule, fallback Sampler) Sampler {
+	return SamplerFunc(func(p SamplingParams) bool {
+		for _, rule := range rules {
+			if rule.matches(p) {
+				return rule.Sampler.ShouldSample(p)
+			}
+		}
+		return fallback.ShouldSample(p)
+	})
+}
+
+// RateLimitingSampler samples at most PerSecond spans per second, allowing
+// bursts of up to one second's worth. A rate of zero or less, including
+// that of the zero value, samples nothing.
+type RateLimitingSampler struct {
+	// Now returns the current time; defaults to time.Now.
+	Now func() time.Time
+
+	perSecond float64
+	mu        sync.Mutex
+	tokens    float64
+	last      time.Time
+}
+
+// NewRateLimitingSampler creates a RateLimitingSampler.
+func NewRateLimitingSampler(perSecond float64) *RateLimitingSampler {
+	return &RateLimitingSampler{Now: time.Now, perSecond: perSecond, tokens: max(perSecond, 1)}
+}
+
+func (s *RateLimitingSampler) ShouldSample(SamplingParams) bool {
+	if !(s.perSecond > 0) {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	if !s.last.IsZero() {
+		s.tokens = min(s.tokens+now.Sub(s.last).Seconds()*s.perSecond, max(s.perSecond, 1))
+	}
+	s.last = now
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+var (
+	samplerMu sync.RWMutex
+	sampler   = ParentBased(AlwaysSample())
+)
+
+// SetSampler sets the sampler used by StartSpan, and so by TracingMiddleware,
+// the Kafka consumer and db.TracedDB. The default, ParentBased(AlwaysSample()),
+// records every trace the caller did not decline. A nil sampler restores the
+// default. Unsampled spans still propagate their IDs but never reach the
+// SpanProcessor. With SetTracerProvider, the sampler of the provider decides
+// instead.
+func SetSampler(s Sampler) {
+	samplerMu.Lock()
+	defer samplerMu.Unlock()
+	if s == nil {
+		s = ParentBased(AlwaysSample())
+	}
+	sampler = s
+}
+
+func currentSampler() Sampler {
+	samplerMu.RLock()
+	defer samplerMu.RUnlock()
+	return sampler
+}
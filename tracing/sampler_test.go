@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useSampler(t *testing.T, s Sampler) {
+	t.Helper()
+	SetSampler(s)
+	t.Cleanup(func() { SetSampler(nil) })
+}
+
+func TestTraceIDRatio(t *testing.T) {
+	assert.True(t, TraceIDRatio(1).ShouldSample(SamplingParams{TraceID: NewTraceID()}))
+	assert.False(t, TraceIDRatio(0).ShouldSample(SamplingParams{TraceID: NewTraceID()}))
+
+	s := TraceIDRatio(0.25)
+	sampled := 0
+	for range 10000 {
+		p := SamplingParams{TraceID: NewTraceID()}
+		decision := s.ShouldSample(p)
+		assert.Equal(t, decision, s.ShouldSample(p), "the decision depends only on the trace ID")
+		if decision {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 2500, sampled, 300)
+
+	assert.True(t, s.ShouldSample(SamplingParams{TraceID: "0000000000000000" + "0000000000000001"}))
+	assert.False(t, s.ShouldSample(SamplingParams{TraceID: "0000000000000000" + "ffffffffffffffff"}))
+}
+
+func TestParentBased(t *testing.T) {
+	s := ParentBased(NeverSample())
+	sampledParent := TraceContext{TraceID: testTraceID, SpanID: testSpanID, Flags: FlagSampled}
+
+	assert.True(t, s.ShouldSample(SamplingParams{Parent: sampledParent}))
+	assert.False(t, s.ShouldSample(SamplingParams{Parent: TraceContext{TraceID: testTraceID, SpanID: testSpanID}}))
+	assert.False(t, s.ShouldSample(SamplingParams{}), "roots are left to the root sampler")
+}
+
+func TestRouteSampler(t *testing.T) {
+	s := RouteSampler([]RouteRule{
+		{Path: "/healthz", Sampler: NeverSample()},
+		{Method: "GET", Path: "/static/*", Sampler: NeverSample()},
+	}, AlwaysSample())
+
+	req := func(method, path string) SamplingParams {
+		return SamplingParams{Attributes: map[string]any{"http.method": method, "url.path": path}}
+	}
+	assert.False(t, s.ShouldSample(req("GET", "/healthz")))
+	assert.True(t, s.ShouldSample(req("GET", "/healthz/deep")), "paths without * match exactly")
+	assert.False(t, s.ShouldSample(req("get", "/static/app.js")))
+	assert.True(t, s.ShouldSample(req("POST", "/static/upload")))
+	assert.True(t, s.ShouldSample(SamplingParams{Name: "db.select"}), "non-HTTP spans use the fallback")
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewRateLimitingSampler(2)
+	s.Now = func() time.Time { return now }
+
+	assert.True(t, s.ShouldSample(SamplingParams{}))
+	assert.True(t, s.ShouldSample(SamplingParams{}))
+	assert.False(t, s.ShouldSample(SamplingParams{}), "burst is one second's worth")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.True(t, s.ShouldSample(SamplingParams{}))
+	assert.False(t, s.ShouldSample(SamplingParams{}))
+
+	now = now.Add(time.Hour)
+	assert.True(t, s.ShouldSample(SamplingParams{}))
+	assert.True(t, s.ShouldSample(SamplingParams{}))
+	assert.False(t, s.ShouldSample(SamplingParams{}), "idle time does not grow the burst")
+}
+
+func TestRateLimitingSampler_NoRate(t *testing.T) {
+	for _, s := range []*RateLimitingSampler{{}, NewRateLimitingSampler(0), NewRateLimitingSampler(-1), NewRateLimitingSampler(math.NaN())} {
+		assert.NotPanics(t, func() {
+			assert.False(t, s.ShouldSample(SamplingParams{}))
+		})
+	}
+
+	s := NewRateLimitingSampler(1)
+	s.Now = nil
+	assert.True(t, s.ShouldSample(SamplingParams{}), "a nil Now falls back to time.Now")
+	assert.False(t, s.ShouldSample(SamplingParams{}))
+}
+
+func TestStartSpan_Sampler(t *testing.T) {
+	rec := recordSpans(t)
+	useSampler(t, ParentBased(NeverSample()))
+
+	ctx, root := StartSpan(context.Background(), "root")
+	_, child := StartSpan(ctx, "child")
+	child.End()
+	root.End()
+	assert.False(t, root.Context().Sampled())
+	assert.False(t, child.Context().Sampled(), "children follow the unsampled root")
+	assert.Empty(t, rec.Ended())
+
+	parent, _ := ParseTraceparent(testTraceparent)
+	_, span := StartSpan(InjectTraceContext(context.Background(), parent), "op")
+	span.End()
+	assert.True(t, span.Context().Sampled(), "a sampled caller is honoured")
+	assert.Equal(t, []*Span{span}, rec.Ended())
+
+	useSampler(t, NeverSample())
+	_, span = StartSpan(context.Background(), "server", WithTraceContext(parent.Child()))
+	assert.False(t, span.Context().Sampled())
+	assert.Equal(t, "00-"+testTraceID+"-"+span.Context().SpanID+"-00", span.Context().Traceparent())
+}
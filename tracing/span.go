@@ -0,0 +1,341 @@
+package tracing
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// SpanKey stores the current *Span in a context.
+const SpanKey ctxKey = "span"
+
+// SpanKind describes the role of a span in a call.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+	SpanKindProducer
+	SpanKindConsumer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	case SpanKindProducer:
+		return "producer"
+	case SpanKindConsumer:
+		return "consumer"
+	}
+	return "internal"
+}
+
+// SpanStatus is the outcome of a span.
+type SpanStatus int
+
+const (
+	StatusUnset SpanStatus = iota
+	StatusOK
+	StatusError
+)
+
+func (s SpanStatus) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusError:
+		return "error"
+	}
+	return "unset"
+}
+
+// SpanEvent is a timestamped annotation on a span.
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]any
+}
+
+// Span is a timed operation within a trace. Spans are safe for concurrent use;
+// changes after End are ignored.
+type Span struct {
+	name  string
+	kind  SpanKind
+	tc    TraceContext
+	start time.Time
+	// otel is the bridged OpenTelemetry span, if any; see SetTracerProvider.
+	otel oteltrace.Span
+
+	mu        sync.Mutex
+	end       time.Time
+	attrs     map[string]any
+	events    []SpanEvent
+	status    SpanStatus
+	statusMsg string
+}
+
+// SpanOption configures StartSpan.
+type SpanOption func(*spanConfig)
+
+type spanConfig struct {
+	kind  SpanKind
+	attrs map[string]any
+	tc    *TraceContext
+}
+
+// WithSpanKind sets the kind of the span; the default is SpanKindInternal.
+func WithSpanKind(kind SpanKind) SpanOption {
+	return func(c *spanConfig) { c.kind = kind }
+}
+
+// WithAttributes sets initial attributes.
+func WithAttributes(attrs map[string]any) SpanOption {
+	return func(c *spanConfig) { c.attrs = attrs }
+}
+
+// WithTraceContext makes the span use tc as its own context instead of
+// deriving a child of the span in ctx. Servers use it with the result of
+// TraceContextFromHeader, which already is a child of the remote caller.
+func WithTraceContext(tc TraceContext) SpanOption {
+	return func(c *spanConfig) { c.tc = &tc }
+}
+
+// StartSpan starts a span as a child of the span or TraceContext in ctx, or
+// as the root of the trace set with InjectTraceIDToContext or of a new trace,
+// and returns a context carrying it. Whether it is recorded is decided by the
+// Sampler set with SetSampler. Callers must
+// call End:
+//
+//	ctx, span := tracing.StartSpan(ctx, "orders.load")
+//	defer span.End()
+func StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	var cfg spanConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var tc TraceContext
+	parent, hasParent := TraceContextFromContext(ctx)
+	traceID, _ := ctx.Value(TraceIDKey).(string)
+	switch {
+	case cfg.tc != nil:
+		tc = *cfg.tc
+	case hasParent && parent.IsValid():
+		tc = parent.Child()
+	case normalizeTraceID(traceID) != "":
+		// Keep a trace ID set with InjectTraceIDToContext.
+		tc = TraceContext{TraceID: normalizeTraceID(traceID), SpanID: NewSpanID(), Flags: FlagSampled}
+	default:
+		tc = NewTraceContext()
+	}
+
+	var otelSpan oteltrace.Span
+	if tr := currentTracer(); tr != nil {
+		if otelCtx, s, bridged, ok := startOTelSpan(ctx, tr, name, cfg, tc); ok {
+			ctx, otelSpan, tc = otelCtx, s, bridged
+		}
+	}
+	if otelSpan == nil {
+		tc = sample(tc, name, cfg)
+	}
+
+	span := &Span{
+		name:  name,
+		kind:  cfg.kind,
+		tc:    tc,
+		start: time.Now(),
+		otel:  otelSpan,
+		attrs: maps.Clone(cfg.attrs),
+	}
+	if span.attrs == nil {
+		span.attrs = make(map[string]any)
+	}
+	if tc.Sampled() {
+		currentSpanProcessor().OnStart(span)
+	}
+
+	ctx = context.WithValue(ctx, SpanKey, span)
+	return InjectTraceContext(ctx, tc), span
+}
+
+// sample sets the sampled flag of tc as decided by the current Sampler. tc
+// still carries the flags inherited from its parent, if any.
+func sample(tc TraceContext, name string, cfg spanConfig) TraceContext {
+	p := SamplingParams{
+		TraceID:    tc.TraceID,
+		Name:       name,
+		Kind:       cfg.kind,
+		Attributes: cfg.attrs,
+	}
+	if tc.ParentSpanID != "" {
+		p.Parent = TraceContext{TraceID: tc.TraceID, SpanID: tc.ParentSpanID, Flags: tc.Flags, State: tc.State}
+	}
+	if currentSampler().ShouldSample(p) {
+		tc.Flags |= FlagSampled
+	} else {
+		tc.Flags &^= FlagSampled
+	}
+	return tc
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(SpanKey).(*Span)
+	return span
+}
+
+// Name returns the span name.
+func (s *Span) Name() string { return s.name }
+
+// Kind returns the span kind.
+func (s *Span) Kind() SpanKind { return s.kind }
+
+// Context returns the trace context of the span.
+func (s *Span) Context() TraceContext { return s.tc }
+
+// StartTime returns when the span started.
+func (s *Span) StartTime() time.Time { return s.start }
+
+// EndTime returns when the span ended, or the zero time.
+func (s *Span) EndTime() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.end
+}
+
+// Duration returns the span duration, or zero if it has not ended.
+func (s *Span) Duration() time.Duration {
+	end := s.EndTime()
+	if end.IsZero() {
+		return 0
+	}
+	return end.Sub(s.start)
+}
+
+// Attributes returns a copy of the attributes.
+func (s *Span) Attributes() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.attrs)
+}
+
+// Events returns a copy of the events.
+func (s *Span) Events() []SpanEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.events)
+}
+
+// Status returns the status and its description.
+func (s *Span) Status() (SpanStatus, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status, s.statusMsg
+}
+
+// SetAttribute sets an attribute.
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.end.IsZero() {
+		s.attrs[key] = value
+		if s.otel != nil {
+			s.otel.SetAttributes(otelAttribute(key, value))
+		}
+	}
+}
+
+// AddEvent records an event.
+func (s *Span) AddEvent(name string, attrs map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.end.IsZero() {
+		event := SpanEvent{Name: name, Time: time.Now(), Attributes: maps.Clone(attrs)}
+		s.events = append(s.events, event)
+		if s.otel != nil {
+			s.otel.AddEvent(name, oteltrace.WithTimestamp(event.Time), oteltrace.WithAttributes(otelAttributes(attrs)...))
+		}
+	}
+}
+
+// SetStatus sets the outcome of the span.
+func (s *Span) SetStatus(status SpanStatus, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.end.IsZero() {
+		s.status, s.statusMsg = status, msg
+		if s.otel != nil {
+			s.otel.SetStatus(otelStatusCode(status), msg)
+		}
+	}
+}
+
+// RecordError records err as an "exception" event and marks the span as
+// failed. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.AddEvent("exception", map[string]any{"exception.message": err.Error()})
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End ends the span and hands it to the SpanProcessor if it is sampled.
+// Calls after the first are ignored.
+func (s *Span) End() {
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.otel != nil {
+		s.otel.End(oteltrace.WithTimestamp(s.end))
+	}
+	if s.tc.Sampled() {
+		currentSpanProcessor().OnEnd(s)
+	}
+}
+
+// SpanProcessor receives sampled spans as they start and end.
+type SpanProcessor interface {
+	OnStart(span *Span)
+	OnEnd(span *Span)
+}
+
+type noopSpanProcessor struct{}
+
+func (noopSpanProcessor) OnStart(*Span) {}
+func (noopSpanProcessor) OnEnd(*Span)   {}
+
+var (
+	processorMu sync.RWMutex
+	processor   SpanProcessor = noopSpanProcessor{}
+)
+
+// SetSpanProcessor sets the processor that receives finished spans. By
+// default spans are discarded. A nil processor restores the default.
+func SetSpanProcessor(p SpanProcessor) {
+	processorMu.Lock()
+	defer processorMu.Unlock()
+	if p == nil {
+		p = noopSpanProcessor{}
+	}
+	processor = p
+}
+
+func currentSpanProcessor() SpanProcessor {
+	processorMu.RLock()
+	defer processorMu.RUnlock()
+	return processor
+}
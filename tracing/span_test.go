@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func recordSpans(t *testing.T) *Recorder {
+	t.Helper()
+	rec := NewRecorder()
+	SetSpanProcessor(rec)
+	t.Cleanup(func() { SetSpanProcessor(nil) })
+	return rec
+}
+
+func TestStartSpan_Tree(t *testing.T) {
+	rec := recordSpans(t)
+
+	ctx, root := StartSpan(context.Background(), "root", WithSpanKind(SpanKindServer))
+	assert.True(t, root.Context().IsValid())
+	assert.Empty(t, root.Context().ParentSpanID, "no parent in ctx starts a new trace")
+	assert.Same(t, root, SpanFromContext(ctx))
+	assert.Equal(t, root.Context().TraceID, GetTraceIDFromContext(ctx))
+
+	childCtx, child := StartSpan(ctx, "child", WithAttributes(map[string]any{"k": "v"}))
+	assert.Equal(t, root.Context().TraceID, child.Context().TraceID)
+	assert.Equal(t, root.Context().SpanID, child.Context().ParentSpanID)
+	assert.Equal(t, SpanKindInternal, child.Kind())
+	tc, ok := TraceContextFromContext(childCtx)
+	require.True(t, ok)
+	assert.Equal(t, child.Context(), tc, "outgoing propagation uses the current span")
+
+	child.End()
+	root.End()
+	assert.Equal(t, []*Span{root, child}, rec.Started())
+	assert.Equal(t, []*Span{child, root}, rec.Ended())
+	assert.Equal(t, "v", child.Attributes()["k"])
+	assert.GreaterOrEqual(t, root.Duration(), child.Duration())
+}
+
+func TestStartSpan_RemoteParent(t *testing.T) {
+	parent, err := ParseTraceparent(testTraceparent)
+	require.NoError(t, err)
+
+	_, span := StartSpan(InjectTraceContext(context.Background(), parent), "op")
+	assert.Equal(t, testTraceID, span.Context().TraceID)
+	assert.Equal(t, testSpanID, span.Context().ParentSpanID)
+
+	tc := parent.Child()
+	_, span = StartSpan(context.Background(), "server", WithTraceContext(tc))
+	assert.Equal(t, tc, span.Context())
+}
+
+func TestSpan_Unsampled(t *testing.T) {
+	rec := recordSpans(t)
+
+	parent := TraceContext{TraceID: testTraceID, SpanID: testSpanID}
+	_, span := StartSpan(InjectTraceContext(context.Background(), parent), "op")
+	span.End()
+
+	assert.False(t, span.Context().Sampled())
+	assert.Empty(t, rec.Started())
+	assert.Empty(t, rec.Ended())
+}
+
+func TestSpan_StatusEventsAndEnd(t *testing.T) {
+	rec := recordSpans(t)
+
+	_, span := StartSpan(context.Background(), "op")
+	span.AddEvent("cache.miss", map[string]any{"key": "a"})
+	span.RecordError(nil)
+	status, _ := span.Status()
+	assert.Equal(t, StatusUnset, status)
+
+	span.RecordError(errors.New("boom"))
+	status, msg := span.Status()
+	assert.Equal(t, StatusError, status)
+	assert.Equal(t, "boom", msg)
+	require.Len(t, span.Events(), 2)
+	assert.Equal(t, "cache.miss", span.Events()[0].Name)
+	assert.Equal(t, "exception", span.Events()[1].Name)
+
+	span.End()
+	end := span.EndTime()
+	span.End()
+	span.SetAttribute("late", true)
+	span.SetStatus(StatusOK, "")
+
+	assert.Len(t, rec.Ended(), 1, "End is idempotent")
+	assert.Equal(t, end, span.EndTime())
+	assert.NotContains(t, span.Attributes(), "late")
+	status, _ = span.Status()
+	assert.Equal(t, StatusError, status, "changes after End are ignored")
+}
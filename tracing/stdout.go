@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// JSONExporter writes each span as one line of JSON, e.g. for log shipping
+// or local debugging.
+type JSONExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONExporter creates a JSONExporter writing to w.
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{enc: json.NewEncoder(w)}
+}
+
+// NewStdoutExporter creates a JSONExporter writing to standard output.
+func NewStdoutExporter() *JSONExporter {
+	return NewJSONExporter(os.Stdout)
+}
+
+func (e *JSONExporter) ExportSpans(_ context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, span := range spans {
+		if err := e.enc.Encode(spanJSONOf(span)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *JSONExporter) Shutdown(context.Context) error { return nil }
+
+type spanJSON struct {
+	TraceID       string          `json:"trace_id"`
+	SpanID        string          `json:"span_id"`
+	ParentSpanID  string          `json:"parent_span_id,omitempty"`
+	Name          string          `json:"name"`
+	Kind          string          `json:"kind"`
+	Start         time.Time       `json:"start"`
+	End           time.Time       `json:"end"`
+	DurationMS    float64         `json:"duration_ms"`
+	Attributes    map[string]any  `json:"attributes,omitempty"`
+	Events        []spanEventJSON `json:"events,omitempty"`
+	Status        string          `json:"status"`
+	StatusMessage string          `json:"status_message,omitempty"`
+}
+
+type spanEventJSON struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func spanJSONOf(s *Span) spanJSON {
+	tc := s.Context()
+	status, msg := s.Status()
+	out := spanJSON{
+		TraceID:       tc.TraceID,
+		SpanID:        tc.SpanID,
+		ParentSpanID:  tc.ParentSpanID,
+		Name:          s.Name(),
+		Kind:          s.Kind().String(),
+		Start:         s.StartTime(),
+		End:           s.EndTime(),
+		DurationMS:    float64(s.Duration()) / float64(time.Millisecond),
+		Attributes:    s.Attributes(),
+		Status:        status.String(),
+		StatusMessage: msg,
+	}
+	for _, ev := range s.Events() {
+		out.Events = append(out.Events, spanEventJSON{Name: ev.Name, Time: ev.Time, Attributes: ev.Attributes})
+	}
+	return out
+}
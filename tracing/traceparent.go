@@ -0,0 +1,218 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// W3C Trace Context headers; their names double as gRPC metadata keys.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceContextKey stores the TraceContext of a request.
+const TraceContextKey ctxKey = "trace_context"
+
+// FlagSampled is the sampled bit of the trace flags.
+const FlagSampled byte = 0x01
+
+// maxTracestateLen is the length up to which tracestate is propagated.
+const maxTracestateLen = 512
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceContext is the W3C Trace Context of the current span.
+type TraceContext struct {
+	// TraceID is 32 lower-case hex digits.
+	TraceID string
+	// SpanID identifies the current span; 16 lower-case hex digits.
+	SpanID string
+	// ParentSpanID is the span ID received from the caller, if any.
+	ParentSpanID string
+	Flags        byte
+	// State is the vendor-specific tracestate, propagated unchanged.
+	State string
+}
+
+// Sampled reports whether the caller recorded the trace.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&FlagSampled != 0
+}
+
+// IsValid reports whether tc has valid trace and span IDs.
+func (tc TraceContext) IsValid() bool {
+	return isHexID(tc.TraceID, 32) && isHexID(tc.SpanID, 16)
+}
+
+// Traceparent formats tc as a version 00 traceparent header.
+func (tc TraceContext) Traceparent() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// Child returns the context of a new span within the same trace.
+func (tc TraceContext) Child() TraceContext {
+	return TraceContext{TraceID: tc.TraceID, SpanID: NewSpanID(), ParentSpanID: tc.SpanID, Flags: tc.Flags, State: tc.State}
+}
+
+// NewTraceID returns a random 16-byte trace ID in hex.
+func NewTraceID() string {
+	return randomHexID(16)
+}
+
+// NewSpanID returns a random 8-byte span ID in hex.
+func NewSpanID() string {
+	return randomHexID(8)
+}
+
+// NewTraceContext starts a new, sampled trace.
+func NewTraceContext() TraceContext {
+	return TraceContext{TraceID: NewTraceID(), SpanID: NewSpanID(), Flags: FlagSampled}
+}
+
+// ParseTraceparent parses a traceparent header. The returned context
+// describes the caller's span: SpanID is the caller's span ID.
+func ParseTraceparent(s string) (TraceContext, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || !isLowerHex(parts[0]) || parts[0] == "ff" {
+		return TraceContext{}, ErrInvalidTraceparent
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return TraceContext{}, ErrInvalidTraceparent
+	}
+	if !isHexID(parts[1], 32) || !isHexID(parts[2], 16) || len(parts[3]) != 2 || !isLowerHex(parts[3]) {
+		return TraceContext{}, ErrInvalidTraceparent
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return TraceContext{TraceID: parts[1], SpanID: parts[2], Flags: flags[0]}, nil
+}
+
+// TraceContextFromHeader returns the context of the span serving r: a child
+// of the caller's traceparent, or of the trace named by the X-Trace-Id alias,
+// or a new trace.
+func TraceContextFromHeader(r *http.Request) TraceContext {
+	return continueTrace(r.Header.Get(TraceparentHeader), r.Header.Get(TracestateHeader), r.Header.Get("X-Trace-Id"))
+}
+
+// TraceContextFromMetadata is TraceContextFromHeader for incoming gRPC
+// metadata.
+func TraceContextFromMetadata(ctx context.Context) TraceContext {
+	var traceparent, tracestate, traceID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		traceparent = firstValue(md, TraceparentHeader)
+		tracestate = firstValue(md, TracestateHeader)
+		traceID = firstValue(md, "x-trace-id")
+	}
+	return continueTrace(traceparent, tracestate, traceID)
+}
+
+func continueTrace(traceparent, tracestate, traceID string) TraceContext {
+	if parent, err := ParseTraceparent(traceparent); err == nil {
+		if len(tracestate) <= maxTracestateLen {
+			parent.State = strings.TrimSpace(tracestate)
+		}
+		return parent.Child()
+	}
+	if id := normalizeTraceID(traceID); id != "" {
+		return TraceContext{TraceID: id, SpanID: NewSpanID(), Flags: FlagSampled}
+	}
+	return NewTraceContext()
+}
+
+// InjectTraceContext returns a new context with tc. The trace ID is also
+// stored under TraceIDKey for GetTraceIDFromContext.
+func InjectTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	ctx = context.WithValue(ctx, TraceContextKey, tc)
+	return InjectTraceIDToContext(ctx, tc.TraceID)
+}
+
+// TraceContextFromContext returns the TraceContext stored in ctx, or that of
+// the active OpenTelemetry span, e.g. one started by otelhttp or otelgrpc.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	if tc, ok := ctx.Value(TraceContextKey).(TraceContext); ok {
+		return tc, true
+	}
+	if sc := oteltrace.SpanContextFromContext(ctx); sc.IsValid() {
+		return TraceContextFromOTel(sc), true
+	}
+	return TraceContext{}, false
+}
+
+// SetTraceContextHeaders writes tc as traceparent and tracestate headers,
+// plus X-Trace-Id for clients that only know the alias.
+func SetTraceContextHeaders(h http.Header, tc TraceContext) {
+	h.Set(TraceparentHeader, tc.Traceparent())
+	if tc.State != "" {
+		h.Set(TracestateHeader, tc.State)
+	} else {
+		h.Del(TracestateHeader)
+	}
+	h.Set("X-Trace-Id", tc.TraceID)
+}
+
+// AppendTraceContextToOutgoingContext propagates the TraceContext of ctx to
+// downstream gRPC calls.
+func AppendTraceContextToOutgoingContext(ctx context.Context) context.Context {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	kv := []string{TraceparentHeader, tc.Traceparent(), "x-trace-id", tc.TraceID}
+	if tc.State != "" {
+		kv = append(kv, TracestateHeader, tc.State)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// normalizeTraceID accepts a 32-digit hex ID, or a UUID as generated by
+// earlier versions, and returns it in traceparent form.
+func normalizeTraceID(id string) string {
+	id = strings.ToLower(strings.ReplaceAll(id, "-", ""))
+	if !isHexID(id, 32) {
+		return ""
+	}
+	return id
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if vals := md.Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func randomHexID(n int) string {
+	b := make([]byte, n)
+	for {
+		_, _ = rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+// isHexID reports whether s is n lower-case hex digits, not all zero.
+func isHexID(s string, n int) bool {
+	return len(s) == n && isLowerHex(s) && strings.Trim(s, "0") != ""
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
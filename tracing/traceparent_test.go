@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID      = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testSpanID + "-01"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, err := ParseTraceparent(testTraceparent)
+	require.NoError(t, err)
+	assert.Equal(t, testTraceID, tc.TraceID)
+	assert.Equal(t, testSpanID, tc.SpanID)
+	assert.True(t, tc.Sampled())
+	assert.Equal(t, testTraceparent, tc.Traceparent())
+
+	tc, err = ParseTraceparent("00-" + testTraceID + "-" + testSpanID + "-00")
+	require.NoError(t, err)
+	assert.False(t, tc.Sampled())
+
+	tc, err = ParseTraceparent("01-" + testTraceID + "-" + testSpanID + "-01-future")
+	require.NoError(t, err, "later versions may append fields")
+	assert.Equal(t, testTraceID, tc.TraceID)
+
+	invalid := []string{
+		"",
+		"garbage",
+		"ff-" + testTraceID + "-" + testSpanID + "-01",
+		"00-" + testTraceID + "-" + testSpanID + "-01-extra",
+		"00-00000000000000000000000000000000-" + testSpanID + "-01",
+		"00-" + testTraceID + "-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanID + "-01",
+		"00-" + testTraceID[:30] + "-" + testSpanID + "-01",
+		"00-" + testTraceID + "-" + testSpanID + "-1",
+	}
+	for _, s := range invalid {
+		_, err := ParseTraceparent(s)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, s)
+	}
+}
+
+func TestNewIDs(t *testing.T) {
+	tc := NewTraceContext()
+	assert.True(t, tc.IsValid())
+	assert.Len(t, tc.TraceID, 32)
+	assert.Len(t, tc.SpanID, 16)
+	assert.True(t, tc.Sampled())
+	assert.NotEqual(t, NewTraceID(), NewTraceID())
+}
+
+func TestTraceContextFromHeader(t *testing.T) {
+	t.Run("Continues traceparent", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Header.Set("traceparent", "00-"+testTraceID+"-"+testSpanID+"-00")
+		req.Header.Set("tracestate", "vendor=abc")
+
+		tc := TraceContextFromHeader(req)
+		assert.Equal(t, testTraceID, tc.TraceID)
+		assert.Equal(t, testSpanID, tc.ParentSpanID)
+		assert.NotEqual(t, testSpanID, tc.SpanID)
+		assert.True(t, tc.IsValid())
+		assert.False(t, tc.Sampled(), "the caller's sampling decision is kept")
+		assert.Equal(t, "vendor=abc", tc.State)
+	})
+
+	t.Run("X-Trace-Id alias", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Header.Set("X-Trace-Id", "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736")
+		assert.Equal(t, testTraceID, TraceContextFromHeader(req).TraceID)
+	})
+
+	t.Run("New trace", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Header.Set("traceparent", "invalid")
+		tc := TraceContextFromHeader(req)
+		assert.True(t, tc.IsValid())
+		assert.Empty(t, tc.ParentSpanID)
+	})
+
+	t.Run("Traceparent wins over alias", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", http.NoBody)
+		req.Header.Set("traceparent", testTraceparent)
+		req.Header.Set("X-Trace-Id", "other")
+		assert.Equal(t, testTraceID, GetOrGenerateTraceIDFromHeader(req))
+	})
+}
+
+func TestTraceContextMetadata(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", testTraceparent, "tracestate", "vendor=abc"))
+	tc := TraceContextFromMetadata(ctx)
+	assert.Equal(t, testTraceID, tc.TraceID)
+	assert.Equal(t, testSpanID, tc.ParentSpanID)
+	assert.Equal(t, testTraceID, GetOrGenerateTraceID(ctx))
+
+	out := AppendTraceContextToOutgoingContext(InjectTraceContext(context.Background(), tc))
+	md, ok := metadata.FromOutgoingContext(out)
+	require.True(t, ok)
+	assert.Equal(t, []string{tc.Traceparent()}, md.Get("traceparent"))
+	assert.Equal(t, []string{"vendor=abc"}, md.Get("tracestate"))
+	assert.Equal(t, []string{testTraceID}, md.Get("x-trace-id"))
+}
+
+func TestSetTraceContextHeaders(t *testing.T) {
+	h := http.Header{}
+	tc := TraceContext{TraceID: testTraceID, SpanID: testSpanID, Flags: FlagSampled, State: "vendor=abc"}
+	SetTraceContextHeaders(h, tc)
+
+	assert.Equal(t, testTraceparent, h.Get("traceparent"))
+	assert.Equal(t, "vendor=abc", h.Get("tracestate"))
+	assert.Equal(t, testTraceID, h.Get("X-Trace-Id"))
+
+	ctx := InjectTraceContext(context.Background(), tc)
+	assert.Equal(t, testTraceID, GetTraceIDFromContext(ctx))
+	got, ok := TraceContextFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, tc, got)
+}
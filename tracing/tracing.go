@@ -3,26 +3,36 @@ package tracing
 import (
 	"context"
 	"net/http"
+	"strings"
 
-	"github.com/google/uuid"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc/metadata"
 )
 
 type ctxKey string
 
 const (
-	TraceIDKey ctxKey = "trace_id"
-	UserIDKey  ctxKey = "user_id"
+	TraceIDKey  ctxKey = "trace_id"
+	UserIDKey   ctxKey = "user_id"
+	TenantIDKey ctxKey = "tenant_id"
 )
 
-// GetOrGenerateTraceID tries to extract a trace ID from gRPC metadata, or generates a new one.
+// TenantIDHeader carries the tenant ID in HTTP requests and Kafka messages;
+// its lower-case form is the gRPC metadata key.
+const TenantIDHeader = "X-Tenant-Id"
+
+// GetOrGenerateTraceID tries to extract a trace ID from gRPC metadata (traceparent, then
+// x-trace-id), or generates a new one.
 func GetOrGenerateTraceID(ctx context.Context) string {
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if tc, err := ParseTraceparent(firstValue(md, TraceparentHeader)); err == nil {
+			return tc.TraceID
+		}
 		if vals := md.Get("x-trace-id"); len(vals) > 0 && vals[0] != "" {
 			return vals[0]
 		}
 	}
-	return uuid.New().String()
+	return NewTraceID()
 }
 
 // GetUserIDFromContext tries to extract a user ID from gRPC metadata.
@@ -35,13 +45,17 @@ func GetUserIDFromContext(ctx context.Context) string {
 	return ""
 }
 
-// GetOrGenerateTraceIDFromHeader extracts trace ID from HTTP headers or generates a new one.
+// GetOrGenerateTraceIDFromHeader extracts trace ID from HTTP headers (traceparent, then
+// X-Trace-Id) or generates a new one.
 func GetOrGenerateTraceIDFromHeader(r *http.Request) string {
+	if tc, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+		return tc.TraceID
+	}
 	traceID := r.Header.Get("X-Trace-Id")
 	if traceID != "" {
 		return traceID
 	}
-	return uuid.New().String()
+	return NewTraceID()
 }
 
 // GetUserIDFromHeader extracts user ID from HTTP headers.
@@ -69,8 +83,12 @@ func InjectUserIDToContext(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, UserIDKey, userID)
 }
 
-// GetTraceIDFromContext extracts the trace ID from context.
+// GetTraceIDFromContext extracts the trace ID from context. The trace ID of
+// an active OpenTelemetry span takes precedence.
 func GetTraceIDFromContext(ctx context.Context) string {
+	if sc := oteltrace.SpanContextFromContext(ctx); sc.IsValid() {
+		return sc.TraceID().String()
+	}
 	if v := ctx.Value(TraceIDKey); v != nil {
 		if s, ok := v.(string); ok {
 			return s
@@ -88,3 +106,43 @@ func GetUserIDFromContextGeneric(ctx context.Context) string {
 	}
 	return GetUserIDFromContext(ctx)
 }
+
+// GetTenantIDFromHeader extracts the tenant ID from HTTP headers.
+func GetTenantIDFromHeader(r *http.Request) string {
+	return r.Header.Get(TenantIDHeader)
+}
+
+// SetTenantIDHeader sets the tenant ID in HTTP response headers.
+func SetTenantIDHeader(w http.ResponseWriter, tenantID string) {
+	w.Header().Set(TenantIDHeader, tenantID)
+}
+
+// InjectTenantIDToContext returns a new context with the tenant ID.
+func InjectTenantIDToContext(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, TenantIDKey, tenantID)
+}
+
+// GetTenantIDFromContext extracts the tenant ID from context, falling back to
+// incoming gRPC metadata.
+func GetTenantIDFromContext(ctx context.Context) string {
+	if v := ctx.Value(TenantIDKey); v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(TenantIDHeader); len(vals) > 0 {
+			return vals[0]
+		}
+	}
+	return ""
+}
+
+// AppendTenantIDToOutgoingContext adds the tenant ID of ctx to the outgoing
+// gRPC metadata, so downstream services see the same tenant.
+func AppendTenantIDToOutgoingContext(ctx context.Context) context.Context {
+	if tenantID := GetTenantIDFromContext(ctx); tenantID != "" {
+		return metadata.AppendToOutgoingContext(ctx, strings.ToLower(TenantIDHeader), tenantID)
+	}
+	return ctx
+}
@@ -89,3 +89,37 @@ func TestContextInjections(t *testing.T) {
 		assert.Equal(t, userID, GetUserIDFromContextGeneric(ctx))
 	})
 }
+
+func TestTenantID(t *testing.T) {
+	t.Run("Context", func(t *testing.T) {
+		ctx := InjectTenantIDToContext(context.Background(), "acme")
+		assert.Equal(t, "acme", GetTenantIDFromContext(ctx))
+		assert.Empty(t, GetTenantIDFromContext(context.Background()))
+	})
+
+	t.Run("gRPC metadata", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "acme"))
+		assert.Equal(t, "acme", GetTenantIDFromContext(ctx))
+	})
+
+	t.Run("Outgoing metadata", func(t *testing.T) {
+		ctx := AppendTenantIDToOutgoingContext(InjectTenantIDToContext(context.Background(), "acme"))
+		md, ok := metadata.FromOutgoingContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, []string{"acme"}, md.Get("x-tenant-id"))
+
+		ctx = AppendTenantIDToOutgoingContext(context.Background())
+		_, ok = metadata.FromOutgoingContext(ctx)
+		assert.False(t, ok)
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Tenant-Id", "acme")
+		assert.Equal(t, "acme", GetTenantIDFromHeader(req))
+
+		w := httptest.NewRecorder()
+		SetTenantIDHeader(w, "acme")
+		assert.Equal(t, "acme", w.Header().Get("X-Tenant-Id"))
+	})
+}
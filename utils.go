@@ -1,15 +1,26 @@
 package utils
 
 import (
-	"os"
 	"strconv"
 	"strings"
 )
 
+// lookupEnv resolves a configuration key. All env helpers go through it so
+// they share a single view of the configured Source, including *_FILE and
+// secret:// indirection. Keys that fail to resolve are treated as missing.
+func lookupEnv(key string) (string, bool) {
+	v, err := resolveEnv(CurrentSource(), key)
+	if err != nil {
+		return "", false
+	}
+	return v.value, v.found
+}
+
 // GetEnvAsBool gets an environment variable as a boolean.
 // It returns the fallback value if the key is missing or the value is not a valid boolean.
+// Use Env to have invalid values reported instead.
 func GetEnvAsBool(key string, fallback bool) bool {
-	if value, ok := os.LookupEnv(key); ok {
+	if value, ok := lookupEnv(key); ok {
 		b, err := strconv.ParseBool(value)
 		if err != nil {
 			return fallback
@@ -22,8 +33,9 @@ func GetEnvAsBool(key string, fallback bool) bool {
 }
 
 // GetEnv gets an environment variable by key or returns the fallback value.
+// Keys are resolved through the Source set with SetSource.
 func GetEnv(key, fallback string) string {
-	if value, ok := os.LookupEnv(key); ok {
+	if value, ok := lookupEnv(key); ok {
 		return value
 	}
 
@@ -32,8 +44,9 @@ func GetEnv(key, fallback string) string {
 
 // GetEnvAsInt gets an environment variable as an int64.
 // It returns the fallback value if the key is missing or the value is not a valid integer.
+// Use Env to have invalid values reported instead.
 func GetEnvAsInt(key string, fallback int64) int64 {
-	if value, ok := os.LookupEnv(key); ok {
+	if value, ok := lookupEnv(key); ok {
 		i, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
 			return fallback
@@ -54,9 +67,38 @@ func SplitAndTrim(s, sep string) []string {
 	return parts
 }
 
-// parseCORSOrigins reads CORS allowed origins from environment variable
+// corsOriginsKey and defaultCORSOrigins define where ParseCORSOrigins reads from.
+const (
+	corsOriginsKey     = "CORS_ALLOWED_ORIGINS"
+	defaultCORSOrigins = "http://localhost:5173"
+)
+
+// ParseCORSOrigins reads CORS allowed origins from environment variable
 // Expected format: CORS_ALLOWED_ORIGINS=http://localhost:5173,https://example.com
+//
+// Entries may also be "*", subdomain wildcards such as "*.example.com" or
+// "https://*.example.com", and regular expressions prefixed with "regex:".
+// Commas inside {} do not split, so "regex:^https://pr-\d{1,5}\.example\.com$"
+// survives intact. Empty entries are dropped.
 func ParseCORSOrigins() []string {
-	originsStr := GetEnv("CORS_ALLOWED_ORIGINS", "http://localhost:5173")
-	return SplitAndTrim(originsStr, ",")
+	return parseCORSOrigins(GetEnv(corsOriginsKey, defaultCORSOrigins))
+}
+
+func parseCORSOrigins(s string) []string {
+	var origins []string
+	depth, start := 0, 0
+	for i := 0; i <= len(s); i++ {
+		switch {
+		case i < len(s) && s[i] == '{':
+			depth++
+		case i < len(s) && s[i] == '}' && depth > 0:
+			depth--
+		case i == len(s) || (s[i] == ',' && depth == 0):
+			if origin := strings.TrimSpace(s[start:i]); origin != "" {
+				origins = append(origins, origin)
+			}
+			start = i + 1
+		}
+	}
+	return origins
 }
@@ -250,6 +250,12 @@ func TestParseCORSOrigins(t *testing.T) {
 			setEnv: true,
 			want:   []string{"https://example.com", "http://localhost:3000", "https://api.example.com"},
 		},
+		{
+			name:   "Patterns",
+			envVal: `*.example.com, https://*.app.example.com,regex:^https://pr-\d{1,5}\.example\.com$,`,
+			setEnv: true,
+			want:   []string{"*.example.com", "https://*.app.example.com", `regex:^https://pr-\d{1,5}\.example\.com$`},
+		},
 		{
 			name:   "Multiple origins with spaces",
 			envVal: "  https://example.com  ,  http://localhost:3000  ",
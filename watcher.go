@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Watcher polls a Source for changes and notifies subscribers of the keys
+// whose values changed. Reloadable sources (such as FileSource or a Layered
+// source containing one) are reloaded on every poll, and KEY_FILE secrets are
+// re-read, so rotated secrets are picked up as well.
+type Watcher struct {
+	src      Source
+	interval time.Duration
+
+	// OnError, if set, receives reload errors and values that failed to parse.
+	OnError func(error)
+
+	mu     sync.Mutex
+	nextID int
+	subs   map[string][]subscription
+	last   map[string]envValue
+}
+
+type subscription struct {
+	id int
+	fn func(value string, ok bool)
+}
+
+// DefaultWatchInterval is the poll interval NewWatcher uses when the given
+// interval is zero or negative.
+const DefaultWatchInterval = 30 * time.Second
+
+// NewWatcher creates a Watcher that polls src every interval once Run is
+// called. An interval of zero or less means DefaultWatchInterval.
+func NewWatcher(src Source, interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	return &Watcher{
+		src:      src,
+		interval: interval,
+		subs:     make(map[string][]subscription),
+		last:     make(map[string]envValue),
+	}
+}
+
+// Subscribe calls fn with the new value of key every time it changes; ok is
+// false when the key was removed. It returns a function that cancels the
+// subscription.
+func (w *Watcher) Subscribe(key string, fn func(value string, ok bool)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, seen := w.last[key]; !seen {
+		v, _ := resolveEnv(w.src, key)
+		w.last[key] = v
+	}
+	w.nextID++
+	id := w.nextID
+	w.subs[key] = append(w.subs[key], subscription{id: id, fn: fn})
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		subs := w.subs[key]
+		for i, s := range subs {
+			if s.id == id {
+				w.subs[key] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Poll reloads the source once and notifies subscribers of changed keys.
+// Subscribers are called synchronously, outside the Watcher's lock.
+func (w *Watcher) Poll() error {
+	var errs []error
+	if r, ok := w.src.(Reloadable); ok {
+		if err := r.Reload(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	type change struct {
+		subs  []subscription
+		value envValue
+	}
+	var changes []change
+
+	w.mu.Lock()
+	for key, subs := range w.subs {
+		v, err := resolveEnv(w.src, key)
+		if err != nil {
+			errs = append(errs, &EnvVarError{Key: key, Err: err})
+			continue
+		}
+		if prev := w.last[key]; prev.found == v.found && prev.value == v.value {
+			continue
+		}
+		w.last[key] = v
+		changes = append(changes, change{subs: append([]subscription(nil), subs...), value: v})
+	}
+	w.mu.Unlock()
+
+	for _, c := range changes {
+		for _, s := range c.subs {
+			s.fn(c.value.value, c.value.found)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run polls until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Poll(); err != nil {
+				w.reportError(err)
+			}
+		}
+	}
+}
+
+func (w *Watcher) reportError(err error) {
+	if w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// Value holds the latest parsed value of a watched key. It is safe for
+// concurrent use.
+type Value[T any] struct {
+	v atomic.Pointer[T]
+}
+
+// Get returns the current value.
+func (v *Value[T]) Get() T {
+	return *v.v.Load()
+}
+
+func (v *Value[T]) set(val T) {
+	v.v.Store(&val)
+}
+
+// WatchValue keeps a typed value in sync with key. The fallback is used while
+// the key is not set; a value that fails to parse is reported to OnError and
+// the previous value is kept.
+func WatchValue[T any](w *Watcher, key string, fallback T, parse func(string) (T, error)) *Value[T] {
+	val := &Value[T]{}
+	update := func(s string, ok bool) {
+		if !ok {
+			val.set(fallback)
+			return
+		}
+		parsed, err := parse(s)
+		if err != nil {
+			w.reportError(&EnvVarError{Key: key, Err: fmt.Errorf("keeping previous value: %w", err)})
+			return
+		}
+		val.set(parsed)
+	}
+
+	val.set(fallback)
+	if v, err := resolveEnv(w.src, key); err == nil {
+		update(v.value, v.found)
+	}
+	w.Subscribe(key, update)
+	return val
+}
+
+// WatchCORSOrigins returns a live view of CORS_ALLOWED_ORIGINS in the format
+// of ParseCORSOrigins, suitable for middlewares.CORSMiddlewareFunc.
+func WatchCORSOrigins(w *Watcher) func() []string {
+	v := WatchValue(w, corsOriginsKey, parseCORSOrigins(defaultCORSOrigins), func(s string) ([]string, error) {
+		return parseCORSOrigins(s), nil
+	})
+	return v.Get
+}
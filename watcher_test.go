@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func rewriteConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the change is visible even on filesystems with coarse mtimes.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcher_Subscribe(t *testing.T) {
+	path := writeConfigFile(t, ".env", "LOG_LEVEL=info\nOTHER=1\n")
+	src, err := NewDotEnvSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(Layered(MapSource{"OTHER": "fixed"}, src), time.Minute)
+
+	type event struct {
+		value string
+		ok    bool
+	}
+	var events []event
+	unsubscribe := w.Subscribe("LOG_LEVEL", func(value string, ok bool) {
+		events = append(events, event{value, ok})
+	})
+
+	if err := w.Poll(); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("unchanged value should not notify, got %v", events)
+	}
+
+	rewriteConfigFile(t, path, "LOG_LEVEL=debug\nOTHER=2\n")
+	if err := w.Poll(); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if want := []event{{"debug", true}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	rewriteConfigFile(t, path, "OTHER=3\n")
+	_ = w.Poll()
+	if want := []event{{"debug", true}, {"", false}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+
+	unsubscribe()
+	rewriteConfigFile(t, path, "LOG_LEVEL=warn\n")
+	_ = w.Poll()
+	if len(events) != 2 {
+		t.Errorf("unsubscribed callback was called: %v", events)
+	}
+}
+
+func TestNewWatcher_DefaultInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		w := NewWatcher(MapSource{}, interval)
+		if w.interval != DefaultWatchInterval {
+			t.Errorf("NewWatcher(%v).interval = %v, want %v", interval, w.interval, DefaultWatchInterval)
+		}
+
+		// Run must not panic on the defaulted interval.
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			w.Run(ctx)
+		}()
+		cancel()
+		<-done
+	}
+}
+
+func TestWatchValue(t *testing.T) {
+	path := writeConfigFile(t, ".env", "MAX_CONNS=10\n")
+	src, err := NewDotEnvSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(src, time.Minute)
+	var reported []error
+	w.OnError = func(err error) { reported = append(reported, err) }
+
+	conns := WatchValue(w, "MAX_CONNS", int64(1), parseInt)
+	if got := conns.Get(); got != 10 {
+		t.Fatalf("Get() = %v, want 10", got)
+	}
+
+	rewriteConfigFile(t, path, "MAX_CONNS=ten\n")
+	_ = w.Poll()
+	if got := conns.Get(); got != 10 {
+		t.Errorf("Get() = %v, want previous value after a bad update", got)
+	}
+	if len(reported) != 1 {
+		t.Errorf("OnError called %d times, want 1", len(reported))
+	}
+
+	rewriteConfigFile(t, path, "\n")
+	_ = w.Poll()
+	if got := conns.Get(); got != 1 {
+		t.Errorf("Get() = %v, want fallback once the key is removed", got)
+	}
+}
+
+func TestWatchCORSOrigins(t *testing.T) {
+	path := writeConfigFile(t, "cors.yaml", "cors:\n  allowed_origins: [\"https://a.com\"]\n")
+	src, err := NewYAMLSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(src, 10*time.Millisecond)
+	origins := WatchCORSOrigins(w)
+
+	if got := origins(); !reflect.DeepEqual(got, []string{"https://a.com"}) {
+		t.Fatalf("origins() = %v", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	rewriteConfigFile(t, path, "cors:\n  allowed_origins: [\"https://a.com\", \"https://b.com\"]\n")
+	deadline := time.Now().Add(2 * time.Second)
+	for len(origins()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("origins() = %v, change was not picked up", origins())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcher_FileSecretRotation(t *testing.T) {
+	secretPath := writeConfigFile(t, "password", "v1")
+	w := NewWatcher(MapSource{"DB_PASSWORD_FILE": secretPath}, time.Minute)
+
+	var got []string
+	w.Subscribe("DB_PASSWORD", func(value string, ok bool) { got = append(got, value) })
+
+	for i := 2; i <= 3; i++ {
+		rewriteConfigFile(t, secretPath, "v"+strconv.Itoa(i))
+		_ = w.Poll()
+	}
+	if !reflect.DeepEqual(got, []string{"v2", "v3"}) {
+		t.Errorf("rotations = %v, want [v2 v3]", got)
+	}
+}